@@ -0,0 +1,25 @@
+# Checkpoint helpers used by transfer.sh to resume an interrupted run.
+# Each completed step is appended to STATE_FILE; a run started with
+# --resume skips every step already recorded there.
+
+# Function to start a fresh checkpoint file
+checkpoint_reset() {
+    : > "$STATE_FILE"
+}
+
+# Function to check if a step was already completed
+checkpoint_done() {
+    local step=$1
+    [ -f "$STATE_FILE" ] && grep -qxF "$step" "$STATE_FILE"
+}
+
+# Function to record a completed step
+checkpoint_mark() {
+    local step=$1
+    echo "$step" >> "$STATE_FILE"
+}
+
+# Function to remove the checkpoint file once the whole transfer succeeded
+checkpoint_clear() {
+    rm -f "$STATE_FILE"
+}
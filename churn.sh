@@ -0,0 +1,32 @@
+# Rate-of-change helpers used by transfer.sh --churn to estimate how much of
+# the source changes per day, which is roughly what a final delta pass has
+# to copy. Based on file modification times, so deletions are not counted.
+
+# Helper to generate the command that sums files and bytes under a directory
+# Prints "<files> <bytes> <changed files> <changed bytes>" for files modified in the last <days> days
+_get_churn_cmd() {
+    local dir=$1
+    local days=$2
+    echo "find \"$dir\" -type f -printf '%T@ %s\\n' 2>/dev/null | awk -v since=\$((\$(date +%s) - $days * 86400)) '{n++; b+=\$2} \$1 >= since {cn++; cb+=\$2} END {printf \"%d %d %d %d\\n\", n, b, cn, cb}'"
+}
+
+# Function to report the estimated daily churn of every source directory
+estimate_churn() {
+    local days=${CHURN_DAYS:-7}
+    local dir cmd_churn files bytes changed_files changed_bytes
+
+    echo -e "${GREEN}#=== Estimating daily churn on $SRCHOST over the last $days days...${RESET}"
+    for dir in "${SRCHOME_DIRS[@]}"; do
+        cmd_churn=$(_get_churn_cmd "$SRCHOME/$dir" "$days")
+        if [ "$SRCHOST" = "localhost" ]; then
+            read -r files bytes changed_files changed_bytes < <(eval "$cmd_churn")
+        else
+            read -r files bytes changed_files changed_bytes < <(ssh -p "$SRCSSHPORT" "$SRCUSER@$SRCHOST" "$cmd_churn")
+        fi
+
+        echo -e "${BLUE}#=== $SRCHOME/$dir${RESET}"
+        awk -v f="${files:-0}" -v b="${bytes:-0}" 'BEGIN {printf "  Total:     %d files, %.1f MB\n", f, b / 1048576}'
+        awk -v f="${changed_files:-0}" -v b="${changed_bytes:-0}" -v d="$days" \
+            'BEGIN {printf "  Per day:   %.1f files, %.1f MB\n", f / d, b / d / 1048576}'
+    done
+}
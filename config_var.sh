@@ -1,6 +1,6 @@
 ##### config.sh
 
-DB_TYPE="mysql"              # Database type: mysql (default), postgresql
+DB_TYPE="mysql"              # Database type: mysql (default), postgresql (pg_dump custom format, restored with pg_restore)
 
 ##### SOURCE CONFIGURATION
 SRCHOST=127.0.0.1      # The source host (e.g., the server where the files are located)
@@ -37,9 +37,85 @@ EXCLUDE_MAP["public_html"]="*.log *.bak"  # Exclusions for public_html directory
 EXCLUDE_MAP["App"]="*.tmp"               # Exclusions for App directory
 # EXCLUDE_MAP["New_folder"]=""            # No exclusions for New_folder directory (can be commented out if not needed)
 
+# How each copied directory is verified against its source: none, size, checksum
+# checksum reads every file on both sides, so reserve it for targets that need it (e.g. NFS)
+VERIFY_MODE="size"
+declare -A VERIFY_MAP
+# VERIFY_MAP["public_html"]="checksum"  # Per destination directory override
+CHECKSUM_ALGO=""                  # Hash used by checksum verification: xxh128, xxh3, xxh64, md5 or md4 (rsync 3.2+), empty = rsync default
+RSYNC_RETRIES=3                   # Retries for transient rsync failures (I/O errors, timeouts, dropped SSH)
+RSYNC_RETRY_DELAY=5               # Seconds before the first retry, doubled after each attempt
+CHANGED_FILES_RETRIES=2           # Extra copy passes when verification finds files that changed during the copy
+VERIFY_STRICT=true                # Fail the transfer if files still differ after the last pass, false = warn (busy live sites)
+VANISHED_FILES="warn"             # Source files deleted during the copy (rotated logs, caches): warn or fail
+
+# Mirror mode: remove destination files that no longer exist on the source
+DELETE_EXTRANEOUS=false           # Enable rsync --delete
+DELETE_MAX_PERCENT=10             # Abort a directory if more than this share of destination entries would be deleted
+DELETE_PROTECT=".env wp-config.php .well-known/"  # Destination paths never deleted (rsync filter patterns)
+DELETE_TRASH=true                 # Move deleted and overwritten files to $DSTHOME/.transfer-trash/<timestamp>/ instead of unlinking them
+DELETE_TRASH_MAX_AGE=30           # Retention: remove trash from runs older than this many days (0 = never)
+
 ##### OPTIONS
-DB_DUMP_NAME="db_backupdump.sql"  # Name of the database dump file
+NICE_LEVEL=""                     # CPU priority for rsync, dumps and restores on both hosts (e.g. 10), empty = unchanged
+IONICE_CLASS=""                   # I/O scheduling class for the same commands: 2 = best-effort, 3 = idle, empty = unchanged
+CAPACITY_CHECK=true               # Precheck: fail if the destination lacks free space or inodes for the source directories
+TRANSFER_QUOTA_MB=0               # Precheck: fail if the files to copy (after exclusions) total more than this, 0 = no limit
+MAX_FILE_SIZE=""                  # Skip files larger than this (rsync size, e.g. 500M or 2G), empty = no limit
+DB_DUMP_NAME=""                   # Name of the database dump files, empty = transfer_<DSTUSER>_<DSTDBNAME> (kept apart per account)
 DB_DUMP_REMOVE=false              # Flag to decide if the dump file should be removed after restore
+SQLITE_FILES=""                   # SQLite databases to copy as consistent snapshots, relative to SRCHOME and under a SRCHOME_DIRS entry (e.g. "App/data/app.db")
+DB_VALIDATE="count"               # After the restore compare tables with the source: none, count (row counts) or checksum (also contents, reads every row;
+                                  # MySQL checksums only match between servers of the same version and row format)
+DB_VALIDATE_STRICT=false          # Fail the transfer on a mismatch instead of warning (only for sources that are read-only during the transfer)
+DB_CHARSET_FROM=""                # MySQL only: convert tables and columns in this charset (e.g. latin1) while transferring, empty = no conversion
+DB_CHARSET_TO="utf8mb4"           # Charset they are converted to
+DB_COLLATION_TO="utf8mb4_unicode_ci"  # Collation for the converted tables and columns
+DB_STREAM=false                   # Pipe the dump straight into the restore instead of staging dump files (for hosts short on disk space)
+DB_DUMP_DIR="/tmp"                # Staging directory for dump files on the source and destination hosts
+DB_DUMP_KEEP=3                    # Retention: number of dumps kept per host (0 = unlimited)
+DB_DUMP_MAX_AGE=7                 # Retention: remove dumps older than this many days (0 = never)
+DB_DUMP_MAX_SIZE_MB=0             # Retention: total size of kept dumps per host in MB (0 = unlimited)
+LOCK_DIR="/tmp/web-db-transfer-locks"  # Lock files preventing concurrent transfers to the same destination
+DRY_RUN_RATE_MB=50                # Assumed copy rate in MB/s for the --dry-run duration estimate
+CHURN_DAYS=7                      # Days of modification times sampled by ./transfer.sh --churn
+STATE_FILE=""                     # Checkpoint file used by ./transfer.sh --resume, empty = /tmp/transfer_<DSTUSER>_<DSTDBNAME>.state
+COMPRESS_CHOICE=""                # rsync 3.2+ wire compression: zstd, lz4, zlibx or zlib, empty = negotiated by rsync
+COMPRESS_LEVEL=""                 # Compression level (e.g. 1 for fast links and busy CPUs, 0 = none), empty = rsync default
+PARTIAL_DIR=".rsync-partial"      # Where partly copied files wait (inside each destination directory) to be continued, empty = restart them
+
+##### SEARCH-REPLACE (optional, WordPress)
+# Rewrites URLs and paths in the destination database after the restore with WP-CLI on the
+# destination, which keeps PHP serialized data valid
+WP_PATH="public_html"             # WordPress directory under DSTHOME (wp-config.php must point to DSTDBNAME)
+SEARCH_REPLACE=()                 # Pairs of "from" "to", applied in order (needs wp-config.php in KEEP_EXISTING_PATTERNS)
+# SEARCH_REPLACE+=("https://old.example.com" "https://new.example.com")
+# SEARCH_REPLACE+=("/home/sshuser1/" "/home/sshuser2/")
+
+##### HOOKS (optional)
+# Commands or URLs run before/after each step: pre_files, post_files, pre_database, post_database
+# Values starting with http:// or https:// are sent as a POST request, anything else runs in bash
+declare -A HOOKS
+# HOOKS["pre_files"]="ssh sshuser2@newhost 'sudo systemctl stop php-fpm'"  # Stop a service before copying
+# HOOKS["post_database"]="https://example.com/hooks/flush-cache"          # Flush caches after the restore
+HOOK_TIMEOUT=60                   # Seconds before a hook is killed
+HOOK_ON_FAILURE="abort"           # What to do when a hook fails: abort, continue, retry
+HOOK_RETRIES=3                    # Attempts made when HOOK_ON_FAILURE="retry"
+
+##### NOTIFICATIONS (optional)
+NOTIFY_EVENTS="start finish failure warning"  # Events to send: start, finish, failure, warning (summary of non-fatal issues)
+NOTIFY_TEMPLATE="[web-db-transfer] {event}: {src} -> {dst} {details}"  # Placeholders: {event} {src} {dst} {details}
+NOTIFY_EMAIL=""                   # Email recipient (sent with the local `mail` command)
+SLACK_WEBHOOK_URL=""              # Slack incoming webhook URL
+TELEGRAM_BOT_TOKEN=""             # Telegram bot token
+TELEGRAM_CHAT_ID=""               # Telegram chat ID the bot posts to
 
 ##### EXCLUDED FILES/DIR (optional)
 # EXCLUDE_FILES="*.log *.tmp *temp /path/to/exclude/dir"  # Global exclusions (applies to all directories if no specific exclusion is set)
+
+##### FILE TYPE POLICIES (optional, apply to every directory)
+SKIP_PATTERNS="*.sock *.pid"      # Never copied (sockets, pid files of running services)
+KEEP_EXISTING_PATTERNS=""         # Copied only if missing at the destination, never overwritten (environment-specific config)
+# KEEP_EXISTING_PATTERNS=".env wp-config-local.php"
+SYMLINK_POLICY="preserve"         # Symlinks: "preserve" (copy as links), "follow" (copy what they point to) or "skip"
+HARDLINKS=true                    # Keep hardlinked files linked at the destination instead of copying each one
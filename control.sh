@@ -0,0 +1,61 @@
+# Signal handling used by transfer.sh to pause, resume or cancel a running
+# transfer. Signals are acted on between steps, so a running rsync or
+# database dump is never interrupted halfway:
+#   kill -USR1 <pid>   pause before the next step
+#   kill -USR2 <pid>   resume a paused transfer
+#   kill -TERM <pid>   cancel (continue later with --resume)
+# A time budget (--max-duration) is checked at the same boundaries.
+
+PAUSED=false
+
+trap 'PAUSED=true; echo -e "${YELLOW}#=== Pause requested, pausing before the next step...${RESET}"' USR1
+trap 'PAUSED=false' USR2
+trap 'echo -e "${RED}#=== Transfer cancelled, run with --resume to continue${RESET}" >&2; exit 130' INT TERM
+
+# Function to block at a step boundary while the transfer is paused
+wait_if_paused() {
+    if [ "$PAUSED" = true ]; then
+        echo -e "${YELLOW}#=== Paused (PID $$), send USR2 to resume...${RESET}"
+        while [ "$PAUSED" = true ]; do
+            sleep 1
+        done
+        echo -e "${GREEN}#=== Resumed${RESET}"
+    fi
+}
+
+# Helper to convert a duration like 90, 90s, 30m or 4h to seconds
+_duration_seconds() {
+    local value=$1
+    case "$value" in
+        *h) echo $((${value%h} * 3600)) ;;
+        *m) echo $((${value%m} * 60)) ;;
+        *s) echo "${value%s}" ;;
+        *) echo "$value" ;;
+    esac
+}
+
+# Function to stop at a step boundary once MAX_DURATION is used up
+# Completed steps stay in the checkpoint, so --resume continues from here
+stop_if_out_of_time() {
+    if [ -z "$MAX_DURATION" ]; then
+        return 0
+    fi
+    local elapsed=$(($(date +%s) - start_time))
+    if [ $elapsed -lt $(_duration_seconds "$MAX_DURATION") ]; then
+        return 0
+    fi
+
+    local done_steps=$(grep -c . "$STATE_FILE" 2>/dev/null)
+    local total_steps=$((${#SRCHOME_DIRS[@]} + 1))
+    if [ -n "$SQLITE_FILES" ]; then
+        total_steps=$((total_steps + 1))
+    fi
+    local percent=$((${done_steps:-0} * 100 / total_steps))
+    echo -e "${YELLOW}#=== Time budget of $MAX_DURATION used up after $elapsed seconds, stopping ($percent% complete)${RESET}"
+    # Exit code 75 (EX_TEMPFAIL) tells schedulers the transfer is unfinished, not failed
+    if [ "$READ_ONLY" != true ]; then
+        echo -e "${YELLOW}#=== Run again with --resume to continue${RESET}"
+        notify "warning" "stopped after the $MAX_DURATION time budget, $percent% complete"
+    fi
+    exit 75
+}
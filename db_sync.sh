@@ -1,5 +1,6 @@
 # Source config variables to ensure they are available
-source ./config_var.sh
+source ./load_config.sh
+source ./priority.sh
 
 # Helper to generate dump command
 _get_dump_cmd() {
@@ -7,14 +8,16 @@ _get_dump_cmd() {
     local user=$2
     local pass=$3
     local db=$4
+    local prefix=$(get_priority_prefix)
     
     case "$type" in
         mysql)
-            echo "mysqldump --single-transaction --quick --no-tablespaces -u \"$user\" -p\"$pass\" \"$db\""
+            # With DB_CHARSET_FROM set the server transcodes the data to DB_CHARSET_TO while dumping
+            echo "${prefix}mysqldump --single-transaction --quick --no-tablespaces ${DB_CHARSET_FROM:+--default-character-set=${DB_CHARSET_TO:-utf8mb4} }-u \"$user\" -p\"$pass\" \"$db\""
             ;;
         postgresql|pgsql)
             # Uses PGPASSWORD env var for non-interactive auth
-            echo "PGPASSWORD=\"$pass\" pg_dump -U \"$user\" -F c -b -v -f - \"$db\""
+            echo "PGPASSWORD=\"$pass\" ${prefix}pg_dump -U \"$user\" -F c -b -v -f - \"$db\""
             ;;
         *)
             echo "echo 'Error: Unknown DB type $type'"
@@ -28,13 +31,25 @@ _get_restore_cmd() {
     local user=$2
     local pass=$3
     local db=$4
+    local prefix=$(get_priority_prefix)
     
     case "$type" in
         mysql)
-            echo "mysql -u \"$user\" -p\"$pass\" \"$db\""
+            # mysqldump adds DROP TABLE IF EXISTS, so restoring over existing tables is safe to repeat
+            if [ -n "$DB_CHARSET_FROM" ]; then
+                # Rewrite DB_CHARSET_FROM charsets and collations in the table definitions (not in the data)
+                local from=$DB_CHARSET_FROM
+                local to=${DB_CHARSET_TO:-utf8mb4}
+                local collation=${DB_COLLATION_TO:-utf8mb4_unicode_ci}
+                echo "{ sed -E '/^INSERT INTO/!{s/(CHARSET|CHARACTER SET)([ =])${from}([^a-z0-9_]|\$)/\\1\\2${to}\\3/g; s/COLLATE([ =])${from}_[a-z0-9_]+/COLLATE\\1${collation}/g}' | ${prefix}mysql --default-character-set=$to -u \"$user\" -p\"$pass\" \"$db\"; }"
+            else
+                echo "${prefix}mysql -u \"$user\" -p\"$pass\" \"$db\""
+            fi
             ;;
         postgresql|pgsql)
-            echo "PGPASSWORD=\"$pass\" pg_restore -U \"$user\" -d \"$db\" -v"
+            # --clean --if-exists drops existing objects first so a re-run doesn't fail on them;
+            # --no-owner gives every object to the restoring user, whose name usually differs from the source
+            echo "PGPASSWORD=\"$pass\" ${prefix}pg_restore --clean --if-exists --no-owner -U \"$user\" -d \"$db\" -v"
             ;;
         *)
             echo "echo 'Error: Unknown DB type $type'"
@@ -42,6 +57,57 @@ _get_restore_cmd() {
     esac
 }
 
+# Helper to generate the dump retention (gc) command
+# Dumps are listed newest first; a dump is removed once it is past DB_DUMP_KEEP,
+# older than DB_DUMP_MAX_AGE days or beyond DB_DUMP_MAX_SIZE_MB in total (0 disables a rule).
+# Leftover .partial dumps from interrupted runs are removed once untouched for an hour.
+_get_gc_cmd() {
+    local dir=${DB_DUMP_DIR:-/tmp}
+    local keep=${DB_DUMP_KEEP:-0}
+    local age=${DB_DUMP_MAX_AGE:-0}
+    local max_mb=${DB_DUMP_MAX_SIZE_MB:-0}
+
+    echo "cd \"$dir\" && n=0 && total=0 && for f in \$(ls -1t -- \"${DB_DUMP_NAME}\"_*.sql 2>/dev/null); do n=\$((n + 1)); total=\$((total + \$(du -m -- \"\$f\" | cut -f1))); if [ $keep -gt 0 -a \$n -gt $keep ] || [ $max_mb -gt 0 -a \$total -gt $max_mb ] || [ $age -gt 0 -a -n \"\$(find \"\$f\" -mtime +$age)\" ]; then rm -f -- \"\$f\" && echo \"  Removed \$f\"; fi; done; find . -maxdepth 1 -name \"${DB_DUMP_NAME}_*.sql.partial\" -mmin +60 -print -delete | sed \"s#^./#  Removed stale #\""
+}
+
+# Function to apply the dump retention policy on the source and destination hosts
+gc_dumps() {
+    local cmd_gc=$(_get_gc_cmd)
+
+    echo -e "${BLUE}#=== Applying dump retention policy in ${DB_DUMP_DIR:-/tmp}...${RESET}"
+    if [[ "$SRCHOST" == "localhost" ]]; then
+        (eval "$cmd_gc")
+    else
+        ssh -p "$SRCSSHPORT" "$SRCUSER@$SRCHOST" "$cmd_gc"
+    fi
+
+    if [[ "$DSTHOST" == "localhost" || "$DSTHOST" == "127.0.0.1" ]]; then
+        # Same directory as the source when both are local
+        if [[ "$SRCHOST" != "localhost" ]]; then
+            (eval "$cmd_gc")
+        fi
+    else
+        ssh -p "$DSTSSHPORT" "$DSTUSER@$DSTHOST" "$cmd_gc"
+    fi
+}
+
+# Function to remove trash (DELETE_TRASH) from runs older than DELETE_TRASH_MAX_AGE days
+# on the destination; every mirror run adds a timestamped directory to it
+gc_trash() {
+    local age=${DELETE_TRASH_MAX_AGE:-0}
+    if [ "$age" -le 0 ]; then
+        return 0
+    fi
+    local cmd_gc="[ -d \"$DSTHOME/.transfer-trash\" ] || exit 0; find \"$DSTHOME/.transfer-trash\" -mindepth 1 -maxdepth 1 -type d -mtime +$age -print -exec rm -rf {} + | sed 's#^#  Removed #'"
+
+    echo -e "${BLUE}#=== Removing trash older than $age days in $DSTHOME/.transfer-trash...${RESET}"
+    if [[ "$DSTHOST" == "localhost" || "$DSTHOST" == "127.0.0.1" ]]; then
+        (eval "$cmd_gc")
+    else
+        ssh -p "$DSTSSHPORT" "$DSTUSER@$DSTHOST" "$cmd_gc"
+    fi
+}
+
 # Function to sync a single database
 # Arguments are optional. If not provided, defaults from config_var.sh are used.
 sync_database() {
@@ -61,13 +127,20 @@ sync_database() {
     
     local db_type=${13:-${DB_TYPE:-mysql}}
 
-    # Use /tmp for dumps to ensure non-root users have write permissions
+    # Use /tmp (DB_DUMP_DIR) for dumps to ensure non-root users have write permissions
     # Add timestamp to avoid collisions
-    local dump_file="/tmp/${DB_DUMP_NAME}_$(date +%s).sql"
-    local dst_dump_file="/tmp/${DB_DUMP_NAME}_$(date +%s).sql"
+    local dump_file="${DB_DUMP_DIR:-/tmp}/${DB_DUMP_NAME}_$(date +%s).sql"
+    local dst_dump_file="${DB_DUMP_DIR:-/tmp}/${DB_DUMP_NAME}_$(date +%s).sql"
     
     echo -e "${YELLOW}#=== Syncing Database ($db_type): $src_db_name -> $dst_db_name${RESET}"
 
+    # List the columns a charset conversion (DB_CHARSET_FROM) will change
+    if [ -n "$DB_CHARSET_FROM" ] && [ "$db_type" = "mysql" ]; then
+        local columns=$(echo "SELECT CONCAT(table_name, '.', column_name) FROM information_schema.columns WHERE table_schema = DATABASE() AND character_set_name = '$DB_CHARSET_FROM' ORDER BY 1;" | _db_query src)
+        echo -e "${BLUE}#=== Converting $(echo "$columns" | grep -c .) column(s) from $DB_CHARSET_FROM to ${DB_CHARSET_TO:-utf8mb4}${RESET}"
+        echo "$columns" | grep . | sed 's/^/    /'
+    fi
+
     # Generate Commands
     local cmd_dump=$(_get_dump_cmd "$db_type" "$src_db_user" "$src_db_pass" "$src_db_name")
     local cmd_restore=$(_get_restore_cmd "$db_type" "$dst_db_user" "$dst_db_pass" "$dst_db_name")
@@ -90,18 +163,48 @@ sync_database() {
         return
     fi
 
+    # STREAMING TRANSFER (DB_STREAM): the dump is piped through this machine
+    # straight into the restore, so no dump file is written on either host
+    if [[ "$DB_STREAM" == true ]]; then
+        echo -e "${BLUE}#=== Streaming dump into destination database...${RESET}"
+
+        local dump_side=(eval "$cmd_dump")
+        if [[ "$src_host" != "localhost" ]]; then
+            dump_side=(ssh -p "$src_ssh_port" "$src_ssh_user@$src_host" "$cmd_dump")
+        fi
+        local restore_side=(eval "$cmd_restore")
+        if [[ "$dst_host" != "localhost" && "$dst_host" != "127.0.0.1" ]]; then
+            restore_side=(ssh -p "$dst_ssh_port" "$dst_ssh_user@$dst_host" "$cmd_restore")
+        fi
+
+        if (set -o pipefail; "${dump_side[@]}" 2>/dev/null | "${restore_side[@]}" 2>/dev/null); then
+            echo -e "  ${GREEN}✔ Database $src_db_name synced successfully${RESET}"
+        else
+            echo -e "  ${RED}✘ Database sync failed${RESET}" >&2
+            exit 1
+        fi
+        return
+    fi
+
     # STANDARD TRANSFER (Dump -> Transfer -> Restore)
     
     # 1. Dump Source
+    # The dump is written to a .partial file and only renamed once complete,
+    # so an interrupted dump never looks like a finished one
     echo -e "${BLUE}#=== Dumping source database...${RESET}"
+    local cmd_dump_file="$cmd_dump > \"$dump_file.partial\" && mv \"$dump_file.partial\" \"$dump_file\""
     if [[ "$src_host" == "localhost" ]]; then
-        eval "$cmd_dump > \"$dump_file\"" 2>/dev/null
+        eval "$cmd_dump_file" 2>/dev/null
     else
         # Note: We need to escape quotes for the SSH command
         # The cmd_dump already contains quotes, so we need to be careful.
         # Simplest way for remote execution of complex command strings is often to write a temp script, 
         # but here we will try to wrap it.
-        ssh -p "$src_ssh_port" "$src_ssh_user@$src_host" "$cmd_dump > \"$dump_file\"" 2>/dev/null
+        ssh -p "$src_ssh_port" "$src_ssh_user@$src_host" "$cmd_dump_file" 2>/dev/null
+    fi
+    if [ $? -ne 0 ]; then
+        echo -e "  ${RED}✘ Database dump failed${RESET}" >&2
+        exit 1
     fi
 
     # 2. Transfer Dump
@@ -122,6 +225,10 @@ sync_database() {
              ssh -p "$src_ssh_port" "$src_ssh_user@$src_host" "scp -P $dst_ssh_port \"$dump_file\" \"$dst_ssh_user@$dst_host:$dst_dump_file\"" >/dev/null 2>&1
         fi
     fi
+    if [ $? -ne 0 ]; then
+        echo -e "  ${RED}✘ Dump file transfer failed${RESET}" >&2
+        exit 1
+    fi
 
     # 3. Restore Destination
     echo -e "${BLUE}#=== Restoring database on destination...${RESET}"
@@ -130,6 +237,10 @@ sync_database() {
     else
         ssh -p "$dst_ssh_port" "$dst_ssh_user@$dst_host" "$cmd_restore < \"$dst_dump_file\"" 2>/dev/null
     fi
+    if [ $? -ne 0 ]; then
+        echo -e "  ${RED}✘ Database restore failed${RESET}" >&2
+        exit 1
+    fi
 
     # 4. Cleanup
     if [[ "$DB_DUMP_REMOVE" == true ]]; then
@@ -151,3 +262,220 @@ sync_database() {
     
     echo -e "  ${GREEN}✔ Database $src_db_name synced successfully${RESET}"
 }
+
+# Helper to map a SQLITE_FILES entry (under a SRCHOME_DIRS entry) to its path
+# under the matching DSTHOME_DIRS entry, empty if it is under none of them
+_sqlite_dst_path() {
+    local file=$1
+    local i
+    for i in "${!SRCHOME_DIRS[@]}"; do
+        if [[ "$file" == "${SRCHOME_DIRS[$i]}/"* ]]; then
+            echo "$DSTHOME/${DSTHOME_DIRS[$i]}/${file#"${SRCHOME_DIRS[$i]}/"}"
+            return 0
+        fi
+    done
+    return 1
+}
+
+# Function to copy SQLite databases (SQLITE_FILES, relative to SRCHOME)
+# A live database file can change while rsync reads it, so a consistent
+# snapshot is taken with the sqlite3 backup API and moved into place instead.
+sync_sqlite_files() {
+    local file
+    for file in $SQLITE_FILES; do
+        local snapshot="${DB_DUMP_DIR:-/tmp}/$(basename "$file").$(date +%s).snapshot"
+        local dst_file=$(_sqlite_dst_path "$file")
+        echo -e "${YELLOW}#=== Syncing SQLite database: $file${RESET}"
+
+        # 1. Snapshot on the source
+        local cmd_snapshot="$(get_priority_prefix)sqlite3 \"$SRCHOME/$file\" \".backup '$snapshot'\""
+        if [[ "$SRCHOST" == "localhost" ]]; then
+            eval "$cmd_snapshot" 2>/dev/null
+        else
+            ssh -p "$SRCSSHPORT" "$SRCUSER@$SRCHOST" "$cmd_snapshot" 2>/dev/null
+        fi
+        if [ $? -ne 0 ]; then
+            echo -e "  ${RED}✘ SQLite snapshot of $file failed${RESET}" >&2
+            exit 1
+        fi
+
+        # 2. Copy it next to the destination file, then rename it over the old copy; journal
+        # files left from the old copy would otherwise be replayed onto the snapshot
+        if [[ "$DSTHOST" == "localhost" || "$DSTHOST" == "127.0.0.1" ]]; then
+            if [[ "$SRCHOST" == "localhost" ]]; then
+                cp "$snapshot" "$dst_file.partial"
+            else
+                scp -P "$SRCSSHPORT" "$SRCUSER@$SRCHOST:$snapshot" "$dst_file.partial" >/dev/null 2>&1
+            fi && rm -f "$dst_file-wal" "$dst_file-shm" "$dst_file-journal" && mv "$dst_file.partial" "$dst_file"
+        else
+            if [[ "$SRCHOST" == "localhost" ]]; then
+                scp -P "$DSTSSHPORT" "$snapshot" "$DSTUSER@$DSTHOST:$dst_file.partial" >/dev/null 2>&1
+            else
+                ssh -p "$SRCSSHPORT" "$SRCUSER@$SRCHOST" "scp -P $DSTSSHPORT \"$snapshot\" \"$DSTUSER@$DSTHOST:$dst_file.partial\"" >/dev/null 2>&1
+            fi && ssh -p "$DSTSSHPORT" "$DSTUSER@$DSTHOST" "rm -f \"$dst_file-wal\" \"$dst_file-shm\" \"$dst_file-journal\" && mv \"$dst_file.partial\" \"$dst_file\""
+        fi
+        local rc=$?
+
+        # 3. The snapshot is only needed for the copy
+        if [[ "$SRCHOST" == "localhost" ]]; then
+            rm -f "$snapshot"
+        else
+            ssh -p "$SRCSSHPORT" "$SRCUSER@$SRCHOST" "rm -f \"$snapshot\""
+        fi
+
+        if [ $rc -ne 0 ]; then
+            echo -e "  ${RED}✘ SQLite database $file could not be copied${RESET}" >&2
+            exit 1
+        fi
+        echo -e "  ${GREEN}✔ SQLite database $file synced successfully${RESET}"
+    done
+}
+
+# Helper to run SQL (read from stdin) against the source or destination database
+# Usage: echo "<sql>" | _db_query <src|dst>
+_db_query() {
+    local side=$1
+    local host port ssh_user user pass db
+    if [ "$side" = "src" ]; then
+        host=$SRCHOST; port=$SRCSSHPORT; ssh_user=$SRCUSER; user=$SRCDBUSER; pass=$SRCDBPASS; db=$SRCDBNAME
+    else
+        host=$DSTHOST; port=$DSTSSHPORT; ssh_user=$DSTUSER; user=$DSTDBUSER; pass=$DSTDBPASS; db=$DSTDBNAME
+    fi
+
+    local cmd_query
+    case "${DB_TYPE:-mysql}" in
+        postgresql|pgsql)
+            cmd_query="PGPASSWORD=\"$pass\" psql -U \"$user\" -d \"$db\" -tA -v ON_ERROR_STOP=1"
+            ;;
+        *)
+            cmd_query="mysql -N -B -u \"$user\" -p\"$pass\" \"$db\""
+            ;;
+    esac
+
+    # As in sync_database, a source at 127.0.0.1 is reached over SSH as SRCUSER
+    if [[ "$host" == "localhost" ]] || [[ "$side" == "dst" && "$host" == "127.0.0.1" ]]; then
+        eval "$cmd_query" 2>/dev/null
+    else
+        ssh -p "$port" "$ssh_user@$host" "$cmd_query" 2>/dev/null
+    fi
+}
+
+# Helper to print "<table> <rows> [<checksum>]" for every table of one side
+_db_table_report() {
+    local side=$1
+    local mode=$2
+    local tables table sql=""
+
+    case "${DB_TYPE:-mysql}" in
+        postgresql|pgsql)
+            tables=$(echo "SELECT tablename FROM pg_tables WHERE schemaname = 'public' ORDER BY 1;" | _db_query "$side") || return 1
+            for table in $tables; do
+                # Checksum: md5 over the sorted md5 of every row
+                if [ "$mode" = "checksum" ]; then
+                    sql="$sql${sql:+ UNION ALL }SELECT '$table' || ' ' || COUNT(*) || ' ' || COALESCE(md5(string_agg(md5(t::text), '' ORDER BY md5(t::text))), '-') FROM \"$table\" t"
+                else
+                    sql="$sql${sql:+ UNION ALL }SELECT '$table' || ' ' || COUNT(*) FROM \"$table\""
+                fi
+            done
+            [ -z "$sql" ] || echo "$sql;" | _db_query "$side"
+            ;;
+        *)
+            tables=$(echo "SHOW TABLES;" | _db_query "$side") || return 1
+            for table in $tables; do
+                sql="$sql${sql:+ UNION ALL }SELECT CONCAT('$table', ' ', COUNT(*)) FROM \`$table\`"
+            done
+            [ -n "$sql" ] || return 0
+            if [ "$mode" = "checksum" ]; then
+                # CHECKSUM TABLE prints "<db>.<table> <checksum>"; add it to the row counts
+                local checksums=$(echo "CHECKSUM TABLE $(echo $tables | sed 's/\([^ ]*\)/`\1`/g; s/ /, /g');" | _db_query "$side") || return 1
+                awk 'NR == FNR { sub(/^[^.]*\./, "", $1); sum[$1] = $2; next } { print $1, $2, sum[$1] }' \
+                    <(echo "$checksums") <(echo "$sql;" | _db_query "$side")
+            else
+                echo "$sql;" | _db_query "$side"
+            fi
+            ;;
+    esac
+}
+
+# Function to compare the tables of the source and destination databases
+# Modes: none (skip), count (table list and row counts), checksum (also table contents)
+# The source is read as it is now, so rows written after the dump show up as differences.
+# Returns 1 if any difference was found, 2 if the validation could not run
+validate_database() {
+    local mode=${1:-count}
+    if [ "$mode" = "none" ]; then
+        return 0
+    fi
+
+    echo -e "  ${BLUE}Validating database ($mode)...${RESET}"
+    local src_report dst_report
+    if ! src_report=$(_db_table_report src "$mode") || ! dst_report=$(_db_table_report dst "$mode"); then
+        echo -e "  ${RED}✘ Database validation could not run${RESET}" >&2
+        return 2
+    fi
+
+    local report=$(awk '
+        NR == FNR { if ($1 != "") { src_rows[$1] = $2; src_sum[$1] = $3 } next }
+        $1 != "" {
+            seen[$1] = 1
+            if (!($1 in src_rows)) print "    Only in destination: " $1
+            else if ($2 != src_rows[$1]) print "    Row count differs: " $1 " (source " src_rows[$1] ", destination " $2 ")"
+            else if ($3 != src_sum[$1]) print "    Checksum differs: " $1
+        }
+        END { for (t in src_rows) if (!(t in seen)) print "    Only in source: " t }
+    ' <(echo "$src_report") <(echo "$dst_report"))
+
+    if [ -n "$report" ]; then
+        echo -e "  ${RED}✘ Database differs from the source:${RESET}" >&2
+        echo "$report" >&2
+        return 1
+    fi
+    echo -e "  ${GREEN}✔ Database validated ($(echo "$src_report" | grep -c .) tables)${RESET}"
+}
+
+# Helper to run a command in the WordPress directory (WP_PATH) on the destination
+_wp_run() {
+    local cmd="cd \"$DSTHOME/${WP_PATH:-public_html}\" && $1"
+    if [[ "$DSTHOST" == "localhost" || "$DSTHOST" == "127.0.0.1" ]]; then
+        (eval "$cmd")
+    else
+        ssh -p "$DSTSSHPORT" "$DSTUSER@$DSTHOST" "$cmd"
+    fi
+}
+
+# Function to rewrite URLs and paths in the destination database (SEARCH_REPLACE)
+# Uses WP-CLI on the destination, which fixes the lengths of PHP serialized
+# strings it changes, and the database settings of the site's wp-config.php.
+search_replace_database() {
+    if [ ${#SEARCH_REPLACE[@]} -eq 0 ]; then
+        return 0
+    fi
+
+    # A wp-config.php copied from the source would point WP-CLI at the source database
+    local wp_db
+    wp_db=$(_wp_run "wp config get DB_NAME && wp config get DB_USER" 2>&1)
+    if [ "$wp_db" != "$DSTDBNAME"$'\n'"$DSTDBUSER" ]; then
+        echo -e "  ${RED}✘ $DSTHOME/${WP_PATH:-public_html}/wp-config.php does not use database $DSTDBNAME as $DSTDBUSER, search-replace not run${RESET}" >&2
+        echo "$wp_db" | sed 's/^/    /' >&2
+        exit 1
+    fi
+
+    local i
+    for ((i = 0; i + 1 < ${#SEARCH_REPLACE[@]}; i += 2)); do
+        local from=${SEARCH_REPLACE[$i]}
+        local to=${SEARCH_REPLACE[$((i + 1))]}
+        echo -e "${BLUE}#=== Replacing '$from' with '$to' in $DSTDBNAME...${RESET}"
+
+        local output
+        output=$(_wp_run "wp search-replace \"$from\" \"$to\" --all-tables-with-prefix --skip-columns=guid --report-changed-only" 2>&1)
+        local rc=$?
+
+        if [ -n "$output" ]; then
+            echo "$output" | sed 's/^/    /'
+        fi
+        if [ $rc -ne 0 ]; then
+            echo -e "  ${RED}✘ Search-replace failed${RESET}" >&2
+            exit 1
+        fi
+    done
+}
@@ -0,0 +1,60 @@
+# Hook helpers used by transfer.sh to run user-defined commands or HTTP
+# calls before and after each step (see HOOKS in config_var.sh).
+
+# Helper to execute a hook once and print its captured output
+_exec_hook() {
+    local hook=$1
+    local output
+
+    if [[ "$hook" =~ ^https?:// ]]; then
+        # HTTP hooks are sent as a POST request
+        output=$(curl -fsS -X POST --max-time "${HOOK_TIMEOUT:-60}" "$hook" 2>&1)
+    else
+        output=$(timeout "${HOOK_TIMEOUT:-60}" bash -c "$hook" 2>&1)
+    fi
+    local rc=$?
+
+    if [ -n "$output" ]; then
+        echo "$output" | sed 's/^/    /'
+    fi
+    if [ $rc -eq 124 ]; then
+        echo -e "  ${YELLOW}Hook timed out after ${HOOK_TIMEOUT:-60} seconds${RESET}" >&2
+    fi
+    return $rc
+}
+
+# Function to run the hook registered for a step (e.g. pre_files, post_database)
+# Failures are handled according to HOOK_ON_FAILURE: abort, continue or retry.
+run_hook() {
+    local name=$1
+    local hook=${HOOKS[$name]}
+    local policy=${HOOK_ON_FAILURE:-abort}
+    local attempts=1
+    local attempt
+
+    if [ -z "$hook" ]; then
+        return 0
+    fi
+    if [ "$policy" = "retry" ]; then
+        attempts=${HOOK_RETRIES:-3}
+    fi
+
+    echo -e "${BLUE}#=== Running $name hook...${RESET}"
+    for ((attempt = 1; attempt <= attempts; attempt++)); do
+        if _exec_hook "$hook"; then
+            echo -e "  ${GREEN}✔ Hook $name succeeded${RESET}"
+            return 0
+        fi
+        if [ $attempt -lt $attempts ]; then
+            echo -e "  ${YELLOW}↻ Retrying hook $name ($attempt/$attempts)...${RESET}"
+            sleep 2
+        fi
+    done
+
+    if [ "$policy" = "continue" ]; then
+        warn "Hook $name failed, continuing"
+        return 0
+    fi
+    echo -e "  ${RED}✘ Hook $name failed${RESET}" >&2
+    exit 1
+}
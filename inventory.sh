@@ -0,0 +1,28 @@
+# Inventory helpers used by transfer.sh --inventory to summarise the source
+# directories by content type (detected from magic bytes with `file`), which
+# helps spot unexpected content (mail spools, core dumps, backups) before
+# migrating it.
+
+# Helper to generate the command that prints "<mime type>\t<files>\t<bytes>" for a directory
+# "//" separates fields, but a path may contain it too (e.g. SRCHOME with a trailing slash),
+# so the path is cut out between the size or mime type and the line ends, which never do
+_get_inventory_cmd() {
+    local dir=$1
+    echo "{ find \"$dir\" -type f -printf 'S//%s//%p\\n'; find \"$dir\" -type f -print0 | xargs -0 -r file -N --mime-type -F '//' | sed 's#^#M//#'; } 2>/dev/null | awk -F '//' '\$1 == \"S\" {size[substr(\$0, length(\$2) + 6)] = \$2; next} {m = \$NF; sub(/^ /, \"\", m); n[m]++; b[m] += size[substr(\$0, 4, length(\$0) - length(\$NF) - 5)]} END {for (m in n) printf \"%s\\t%d\\t%d\\n\", m, n[m], b[m]}'"
+}
+
+# Function to print the content type inventory of every source directory
+print_inventory() {
+    local dir cmd_inventory
+
+    echo -e "${GREEN}#=== Content inventory of $SRCHOST...${RESET}"
+    for dir in "${SRCHOME_DIRS[@]}"; do
+        cmd_inventory=$(_get_inventory_cmd "$SRCHOME/$dir")
+        echo -e "${BLUE}#=== $SRCHOME/$dir${RESET}"
+        if [ "$SRCHOST" = "localhost" ]; then
+            eval "$cmd_inventory"
+        else
+            ssh -p "$SRCSSHPORT" "$SRCUSER@$SRCHOST" "$cmd_inventory"
+        fi | sort -t $'\t' -k3,3nr | awk -F '\t' '{printf "  %-40s %8d files %10.1f MB\n", $1, $2, $3 / 1048576}'
+    done
+}
@@ -0,0 +1,22 @@
+# Load config_var.sh (or CONFIG_FILE), then the profile named by PROFILE
+# (profiles/$PROFILE.sh) on top of it so a profile only has to set the
+# values that differ.
+CONFIG_FILE=${CONFIG_FILE:-./config_var.sh}
+if [ ! -f "$CONFIG_FILE" ]; then
+    echo -e "\033[0;31m#=== ERROR: Config file $CONFIG_FILE not found!\033[0m" >&2
+    exit 1
+fi
+source "$CONFIG_FILE"
+
+if [ -n "$PROFILE" ]; then
+    if [ ! -f "./profiles/$PROFILE.sh" ]; then
+        echo -e "\033[0;31m#=== ERROR: Profile ./profiles/$PROFILE.sh not found!\033[0m" >&2
+        exit 1
+    fi
+    source "./profiles/$PROFILE.sh"
+fi
+
+# Defaults named after the destination account, set once the profile is loaded so
+# each profile gets its own checkpoint and its own dumps to prune
+STATE_FILE=${STATE_FILE:-/tmp/transfer_${DSTUSER}_${DSTDBNAME}.state}
+DB_DUMP_NAME=${DB_DUMP_NAME:-transfer_${DSTUSER}_${DSTDBNAME}}
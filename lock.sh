@@ -0,0 +1,71 @@
+# Lock helpers used by transfer.sh so two transfers can't write the same
+# destination directory or database at the same time. Locks are files in
+# LOCK_DIR on the machine running the transfer.
+
+HELD_LOCKS=()
+
+# Helper to turn a lock key into a lock file path
+_lock_file() {
+    local key=$1
+    echo "$LOCK_DIR/$(printf '%s' "$key" | tr -c 'A-Za-z0-9._-' '_').lock"
+}
+
+# Helper to check if the process that created a lock file is gone
+_lock_stale() {
+    local file=$1
+    local pid host
+    read -r pid host _ < "$file"
+    [ "$host" = "$(hostname)" ] && ! ps -p "$pid" >/dev/null 2>&1
+}
+
+# Function to acquire a lock, failing if another running transfer holds it
+acquire_lock() {
+    local key=$1
+    local file=$(_lock_file "$key")
+
+    mkdir -p "$LOCK_DIR"
+    if [ -f "$file" ] && _lock_stale "$file"; then
+        warn "Removed stale lock for $key"
+        rm -f "$file"
+    fi
+
+    # noclobber makes the redirection fail if the lock file already exists
+    if ! (set -o noclobber; echo "$$ $(hostname) $(date +%s) $key" > "$file") 2>/dev/null; then
+        local pid host started
+        read -r pid host started _ < "$file"
+        echo -e "${RED}#=== ERROR: $key is locked by PID $pid on $host since $(date -d "@$started")!${RESET}" >&2
+        exit 1
+    fi
+    HELD_LOCKS+=("$file")
+}
+
+# Function to release every lock taken by this transfer
+release_locks() {
+    local file
+    for file in "${HELD_LOCKS[@]}"; do
+        rm -f "$file"
+    done
+    HELD_LOCKS=()
+}
+
+# Function to print all locks in LOCK_DIR and whether they are still held
+list_locks() {
+    local file pid host started key status
+    local found=false
+
+    for file in "$LOCK_DIR"/*.lock; do
+        [ -f "$file" ] || continue
+        found=true
+        read -r pid host started key < "$file"
+        if _lock_stale "$file"; then
+            status="${YELLOW}stale${RESET}"
+        else
+            status="${GREEN}active${RESET}"
+        fi
+        echo -e "$key  pid=$pid host=$host since=$(date -d "@$started" '+%F %T')  [$status]"
+    done
+
+    if [ "$found" = false ]; then
+        echo "No locks in $LOCK_DIR"
+    fi
+}
@@ -0,0 +1,50 @@
+# Notification helpers used by transfer.sh to report start, finish, failure
+# and warning events by email, Slack webhook and/or Telegram bot
+# (see NOTIFICATIONS in config_var.sh).
+
+# Helper to escape a string for use inside a JSON string value
+_json_escape() {
+    local str=$1
+    str=${str//\\/\\\\}
+    str=${str//\"/\\\"}
+    str=${str//$'\n'/\\n}
+    echo "$str"
+}
+
+# Helper to warn when a notifier fails (never aborts the transfer)
+_notify_failed() {
+    local channel=$1
+    warn "Could not send $channel notification"
+}
+
+# Function to send a notification for an event (start, finish, failure, warning)
+notify() {
+    local event=$1
+    local details=$2
+
+    # Only send events listed in NOTIFY_EVENTS
+    if [[ ! " ${NOTIFY_EVENTS} " =~ " $event " ]]; then
+        return 0
+    fi
+
+    # Fill in the message template
+    local message=${NOTIFY_TEMPLATE:-"[web-db-transfer] {event}: {src} -> {dst} {details}"}
+    message=${message//\{event\}/$event}
+    message=${message//\{src\}/$SRCHOST:$SRCDBNAME}
+    message=${message//\{dst\}/$DSTHOST:$DSTDBNAME}
+    message=${message//\{details\}/$details}
+
+    if [ -n "$NOTIFY_EMAIL" ]; then
+        echo "$message" | mail -s "[web-db-transfer] Transfer $event" "$NOTIFY_EMAIL" 2>/dev/null || _notify_failed "email"
+    fi
+
+    if [ -n "$SLACK_WEBHOOK_URL" ]; then
+        curl -fsS --max-time 10 -H "Content-Type: application/json" \
+            -d "{\"text\": \"$(_json_escape "$message")\"}" "$SLACK_WEBHOOK_URL" >/dev/null 2>&1 || _notify_failed "Slack"
+    fi
+
+    if [ -n "$TELEGRAM_BOT_TOKEN" ] && [ -n "$TELEGRAM_CHAT_ID" ]; then
+        curl -fsS --max-time 10 "https://api.telegram.org/bot$TELEGRAM_BOT_TOKEN/sendMessage" \
+            --data-urlencode "chat_id=$TELEGRAM_CHAT_ID" --data-urlencode "text=$message" >/dev/null 2>&1 || _notify_failed "Telegram"
+    fi
+}
@@ -42,6 +42,24 @@ check_mysql_connection() {
     fi
 }
 
+# Function to check PostgreSQL database connection
+# Usage: check_postgresql_connection <src|dst> <host> <port> <ssh user> <db user> <password> <dbname>
+check_postgresql_connection() {
+    local side=$1
+    local host=$2
+    local port=$3
+    local ssh_user=$4
+    local user=$5
+    local password=$6
+    local dbname=$7
+    local cmd_check="PGPASSWORD=\"$password\" psql -U \"$user\" -d \"$dbname\" -tAc \"SELECT 1\""
+
+    if ! _run_on_host "$side" "$host" "$port" "$ssh_user" "$cmd_check" >/dev/null 2>&1; then
+        echo -e "${RED}#=== ERROR: Cannot connect to PostgreSQL database $dbname on $host as $user!${RESET}" >&2
+        exit 1
+    fi
+}
+
 # Function to check SSH connection
 check_ssh_connection() {
     local host=$1
@@ -65,8 +83,172 @@ check_ssh_connection() {
     fi
 }
 
-# Load configuration(vars) from config_vars.sh
-source ./config_var.sh
+# Helper to run a check command on a host (locally or over SSH)
+# Like sync_database, only the destination treats 127.0.0.1 as local; a source at
+# 127.0.0.1 is reached over SSH so the check runs as SRCUSER
+_run_on_host() {
+    local side=$1
+    local host=$2
+    local port=$3
+    local user=$4
+    local cmd=$5
+    if [ "$host" = "localhost" ] || { [ "$side" != "src" ] && [ "$host" = "127.0.0.1" ]; }; then
+        (eval "$cmd")
+    else
+        ssh -p "$port" "$user@$host" "$cmd" 2>/dev/null
+    fi
+}
+
+# Function to check the commands a transfer runs are installed on a host
+# Usage: check_tools <src|dst|local> <host> <port> <user> <command...>
+check_tools() {
+    local side=$1
+    local host=$2
+    local port=$3
+    local user=$4
+    shift 4
+
+    local missing=$(_run_on_host "$side" "$host" "$port" "$user" "for t in $*; do command -v \$t >/dev/null 2>&1 || echo \$t; done")
+    if [ -n "$missing" ]; then
+        echo -e "${RED}#=== ERROR: Missing on $host: $(echo $missing)! Install them and run the precheck again.${RESET}" >&2
+        exit 1
+    fi
+}
+
+# Function to check the dump staging directory (DB_DUMP_DIR) is writable on a host
+# Usage: check_dump_dir <src|dst> <host> <port> <user>
+check_dump_dir() {
+    local side=$1
+    local host=$2
+    local port=$3
+    local user=$4
+    local dir=${DB_DUMP_DIR:-/tmp}
+
+    if ! _run_on_host "$side" "$host" "$port" "$user" "[ -d \"$dir\" ] && [ -w \"$dir\" ]"; then
+        echo -e "${RED}#=== ERROR: Dump directory $dir is missing or not writable on $host! Create it or change DB_DUMP_DIR.${RESET}" >&2
+        exit 1
+    fi
+}
+
+# Helper to generate the command printing "<KB> <entries>" used by a list of quoted paths
+# Hardlinked files are counted once when HARDLINKS keeps them linked, like rsync -H stores them
+_get_usage_cmd() {
+    local paths=$1
+    if [ "$HARDLINKS" = true ]; then
+        echo "echo \$(du -sck $paths 2>/dev/null | tail -1 | cut -f1) \$(find $paths -printf '%D:%i\\n' 2>/dev/null | sort -u | wc -l)"
+    else
+        echo "echo \$(du -sckl $paths 2>/dev/null | tail -1 | cut -f1) \$(find $paths 2>/dev/null | wc -l)"
+    fi
+}
+
+# Function to check the destination filesystem has room (bytes and inodes) for the source directories
+# Counts only what the destination does not already hold, so a re-sync of a large site fits
+check_destination_capacity() {
+    local src_paths=""
+    local dst_paths=""
+    local i
+    for i in "${!SRCHOME_DIRS[@]}"; do
+        src_paths="$src_paths \"$SRCHOME/${SRCHOME_DIRS[$i]}\""
+        dst_paths="$dst_paths \"$DSTHOME/${DSTHOME_DIRS[$i]}\""
+    done
+
+    # Source usage: "<KB> <entries>"
+    local cmd_usage=$(_get_usage_cmd "$src_paths")
+    # Destination free space and what a previous sync already put there:
+    # "<free KB> <total inodes> <free inodes> <existing KB> <existing entries>"
+    local cmd_free="echo \$(df -Pk \"$DSTHOME\" | awk 'NR==2 {print \$4}') \$(df -Pi \"$DSTHOME\" | awk 'NR==2 {print \$2, \$4}') \$($(_get_usage_cmd "$dst_paths"))"
+
+    local used_kb entries free_kb total_inodes free_inodes dst_kb dst_entries
+    if [ "$SRCHOST" = "localhost" ]; then
+        read -r used_kb entries < <(eval "$cmd_usage")
+    else
+        read -r used_kb entries < <(ssh -p "$SRCSSHPORT" "$SRCUSER@$SRCHOST" "$cmd_usage")
+    fi
+    if [ "$DSTHOST" = "localhost" ] || [ "$DSTHOST" = "127.0.0.1" ]; then
+        read -r free_kb total_inodes free_inodes dst_kb dst_entries < <(eval "$cmd_free" 2>/dev/null)
+    else
+        read -r free_kb total_inodes free_inodes dst_kb dst_entries < <(ssh -p "$DSTSSHPORT" "$DSTUSER@$DSTHOST" "$cmd_free" 2>/dev/null)
+    fi
+
+    if [ -z "$free_kb" ]; then
+        warn "Could not read free space of $DSTHOME on $DSTHOST, skipping capacity check"
+        return 0
+    fi
+
+    # Only the part not already at the destination (from an earlier sync) needs room
+    local needed_kb=$((${used_kb:-0} - ${dst_kb:-0}))
+    local needed_entries=$((${entries:-0} - ${dst_entries:-0}))
+    if [ $needed_kb -gt "$free_kb" ]; then
+        echo -e "${RED}#=== ERROR: Source needs $((needed_kb / 1024)) MB more but only $((free_kb / 1024)) MB is free on $DSTHOST:$DSTHOME!${RESET}" >&2
+        exit 1
+    fi
+    # Filesystems with dynamic inodes (e.g. btrfs) report 0 total inodes
+    if [ "${total_inodes:-0}" -gt 0 ] && [ $needed_entries -gt "${free_inodes:-0}" ]; then
+        echo -e "${RED}#=== ERROR: Source needs $needed_entries more files and directories but only $free_inodes inodes are free on $DSTHOST:$DSTHOME!${RESET}" >&2
+        exit 1
+    fi
+}
+
+# Function to check the source directories fit TRANSFER_QUOTA_MB, counting only the files
+# rsync would copy (EXCLUDE_MAP/EXCLUDE_FILES, SKIP_PATTERNS and MAX_FILE_SIZE applied)
+check_transfer_quota() {
+    local total_bytes=0
+    local dir exclude
+    for dir in "${SRCHOME_DIRS[@]}"; do
+        local options=""
+        for exclude in ${EXCLUDE_MAP[$dir]:-$EXCLUDE_FILES} $SKIP_PATTERNS; do
+            options="$options --exclude='$exclude'"
+        done
+        if [ -n "$MAX_FILE_SIZE" ]; then
+            options="$options --max-size=$MAX_FILE_SIZE"
+        fi
+        if [ "${SYMLINK_POLICY:-preserve}" = "follow" ]; then
+            options="$options --copy-links"
+        fi
+
+        # --list-only on the source reports the "Total file size" of the transfer set
+        local cmd_size="rsync -r --list-only --stats $options \"$SRCHOME/$dir/\" 2>/dev/null | sed -n 's/^Total file size: \([0-9,]*\).*/\1/p' | tr -d ','"
+        local bytes=$(_run_on_host src "$SRCHOST" "$SRCSSHPORT" "$SRCUSER" "$cmd_size")
+        if [ -z "$bytes" ]; then
+            warn "Could not measure $SRCHOME/$dir on $SRCHOST, skipping TRANSFER_QUOTA_MB check"
+            return 0
+        fi
+        total_bytes=$((total_bytes + bytes))
+    done
+
+    if [ $total_bytes -gt $((TRANSFER_QUOTA_MB * 1048576)) ]; then
+        echo -e "${RED}#=== ERROR: Transfer has $((total_bytes / 1048576)) MB of files, more than the $TRANSFER_QUOTA_MB MB allowed by TRANSFER_QUOTA_MB!${RESET}" >&2
+        exit 1
+    fi
+}
+
+source ./warnings.sh
+
+# Parse command line options (when run on its own)
+while [ $# -gt 0 ]; do
+    case "$1" in
+        --lint)
+            PRECHECK_LINT=true  # Only validate the configuration, skip connectivity checks
+            ;;
+        --config)
+            CONFIG_FILE=$2      # Used by load_config.sh instead of ./config_var.sh
+            shift
+            ;;
+        --profile)
+            PROFILE=$2          # Loads profiles/$PROFILE.sh on top of the config
+            shift
+            ;;
+        *)
+            echo "Unknown option: $1" >&2
+            echo "Usage: $0 [--config FILE] [--profile NAME] [--lint]" >&2
+            exit 1
+            ;;
+    esac
+    shift
+done
+
+# Load configuration(vars) from config_vars.sh (and the selected profile)
+source ./load_config.sh
 
 # Check required variables from config_vars.sh
 check_var "SRCHOST" "$SRCHOST"
@@ -95,13 +277,152 @@ if [ ${#DSTHOME_DIRS[@]} -eq 0 ]; then
     exit 1
 fi
 
-# Check source MySQL database connectivity
-echo -e "${YELLOW}#=== Checking source MySQL database connectivity...${RESET}"
-check_mysql_connection "$SRCHOST" "$SRCSSHPORT" "$SRCDBUSER" "$SRCDBPASS" "$SRCDBNAME"
+# Check every source directory has a matching destination directory
+if [ ${#SRCHOME_DIRS[@]} -ne ${#DSTHOME_DIRS[@]} ]; then
+    echo -e "${RED}#=== ERROR: SRCHOME_DIRS and DSTHOME_DIRS must have the same number of entries!${RESET}" >&2
+    exit 1
+fi
+
+# SEARCH_REPLACE is a list of "from" "to" pairs
+if [ $((${#SEARCH_REPLACE[@]} % 2)) -ne 0 ]; then
+    echo -e "${RED}#=== ERROR: SEARCH_REPLACE must list \"from\" \"to\" pairs, got an odd number of entries!${RESET}" >&2
+    exit 1
+fi
 
-# Check destination MySQL database connectivity
-echo -e "${YELLOW}#=== Checking destination MySQL database connectivity...${RESET}"
-check_mysql_connection "$DSTHOST" "$DSTSSHPORT" "$DSTDBUSER" "$DSTDBPASS" "$DSTDBNAME"
+# SEARCH_REPLACE runs WP-CLI with the destination's wp-config.php, so the files step
+# must not replace it with the source's (unless WP_PATH is outside the copied directories)
+if [ ${#SEARCH_REPLACE[@]} -gt 0 ]; then
+    wp_config_kept=true
+    wp_dir=${WP_PATH:-public_html}
+    for dir in "${DSTHOME_DIRS[@]}"; do
+        if [ "${wp_dir%%/*}" = "$dir" ]; then
+            wp_config_kept=false
+        fi
+    done
+    for pattern in $KEEP_EXISTING_PATTERNS $SKIP_PATTERNS; do
+        if [[ "wp-config.php" == ${pattern##*/} ]]; then
+            wp_config_kept=true
+        fi
+    done
+    if [ "$wp_config_kept" != true ]; then
+        echo -e "${RED}#=== ERROR: SEARCH_REPLACE needs the destination's wp-config.php, add wp-config.php to KEEP_EXISTING_PATTERNS!${RESET}" >&2
+        exit 1
+    fi
+fi
+
+# Check option values
+case "${DB_TYPE:-mysql}" in
+    mysql|postgresql|pgsql) ;;
+    *)
+        echo -e "${RED}#=== ERROR: DB_TYPE must be mysql or postgresql, got '$DB_TYPE'!${RESET}" >&2
+        exit 1
+        ;;
+esac
+if [ -n "$DB_CHARSET_FROM" ] && [ "${DB_TYPE:-mysql}" != "mysql" ]; then
+    echo -e "${RED}#=== ERROR: DB_CHARSET_FROM is only supported for MySQL!${RESET}" >&2
+    exit 1
+fi
+case "${DB_VALIDATE:-count}" in
+    none|count|checksum) ;;
+    *)
+        echo -e "${RED}#=== ERROR: DB_VALIDATE must be none, count or checksum, got '$DB_VALIDATE'!${RESET}" >&2
+        exit 1
+        ;;
+esac
+case "$COMPRESS_CHOICE" in
+    ""|zstd|lz4|zlibx|zlib) ;;
+    *)
+        echo -e "${RED}#=== ERROR: COMPRESS_CHOICE must be zstd, lz4, zlibx or zlib, got '$COMPRESS_CHOICE'!${RESET}" >&2
+        exit 1
+        ;;
+esac
+if ! [[ "$COMPRESS_LEVEL" =~ ^[0-9]*$ ]]; then
+    echo -e "${RED}#=== ERROR: COMPRESS_LEVEL must be a number, got '$COMPRESS_LEVEL'!${RESET}" >&2
+    exit 1
+fi
+case "$CHECKSUM_ALGO" in
+    ""|xxh128|xxh3|xxh64|md5|md4) ;;
+    *)
+        echo -e "${RED}#=== ERROR: CHECKSUM_ALGO must be xxh128, xxh3, xxh64, md5 or md4, got '$CHECKSUM_ALGO'!${RESET}" >&2
+        exit 1
+        ;;
+esac
+for verify_mode in "${VERIFY_MODE:-none}" "${VERIFY_MAP[@]}"; do
+    case "$verify_mode" in
+        none|size|checksum) ;;
+        *)
+            echo -e "${RED}#=== ERROR: Verification mode must be none, size or checksum, got '$verify_mode'!${RESET}" >&2
+            exit 1
+            ;;
+    esac
+done
+case "${VANISHED_FILES:-warn}" in
+    warn|fail) ;;
+    *)
+        echo -e "${RED}#=== ERROR: VANISHED_FILES must be warn or fail, got '$VANISHED_FILES'!${RESET}" >&2
+        exit 1
+        ;;
+esac
+case "${SYMLINK_POLICY:-preserve}" in
+    preserve|follow|skip) ;;
+    *)
+        echo -e "${RED}#=== ERROR: SYMLINK_POLICY must be preserve, follow or skip, got '$SYMLINK_POLICY'!${RESET}" >&2
+        exit 1
+        ;;
+esac
+# Ports are required; the other settings fall back to their defaults when unset
+for number_var in SRCSSHPORT DSTSSHPORT DELETE_MAX_PERCENT RSYNC_RETRIES RSYNC_RETRY_DELAY CHANGED_FILES_RETRIES TRANSFER_QUOTA_MB DELETE_TRASH_MAX_AGE; do
+    if [ -z "${!number_var}" ] && [[ ! "$number_var" =~ PORT$ ]]; then
+        continue
+    fi
+    if ! [[ "${!number_var}" =~ ^[0-9]+$ ]]; then
+        echo -e "${RED}#=== ERROR: $number_var must be a number, got '${!number_var}'!${RESET}" >&2
+        exit 1
+    fi
+done
+for dir in "${!EXCLUDE_MAP[@]}"; do
+    if [[ ! " ${SRCHOME_DIRS[*]} " =~ " $dir " ]]; then
+        warn "EXCLUDE_MAP entry '$dir' does not match any SRCHOME_DIRS entry"
+    fi
+done
+
+# SQLite databases are copied to the DSTHOME_DIRS entry matching their SRCHOME_DIRS entry
+for file in $SQLITE_FILES; do
+    sqlite_dir_found=false
+    for dir in "${SRCHOME_DIRS[@]}"; do
+        if [[ "$file" == "$dir/"* ]]; then
+            sqlite_dir_found=true
+        fi
+    done
+    if [ "$sqlite_dir_found" != true ]; then
+        echo -e "${RED}#=== ERROR: SQLITE_FILES entry '$file' is not under any SRCHOME_DIRS entry!${RESET}" >&2
+        exit 1
+    fi
+done
+
+if [ "$PRECHECK_LINT" = true ]; then
+    echo -e "${GREEN}#=== Configuration is valid${PROFILE:+ (profile $PROFILE)}${RESET}"
+    exit 0
+fi
+
+case "${DB_TYPE:-mysql}" in
+    postgresql|pgsql)
+        # Check source and destination PostgreSQL database connectivity
+        echo -e "${YELLOW}#=== Checking source PostgreSQL database connectivity...${RESET}"
+        check_postgresql_connection src "$SRCHOST" "$SRCSSHPORT" "$SRCUSER" "$SRCDBUSER" "$SRCDBPASS" "$SRCDBNAME"
+        echo -e "${YELLOW}#=== Checking destination PostgreSQL database connectivity...${RESET}"
+        check_postgresql_connection dst "$DSTHOST" "$DSTSSHPORT" "$DSTUSER" "$DSTDBUSER" "$DSTDBPASS" "$DSTDBNAME"
+        ;;
+    *)
+        # Check source MySQL database connectivity
+        echo -e "${YELLOW}#=== Checking source MySQL database connectivity...${RESET}"
+        check_mysql_connection "$SRCHOST" "$SRCSSHPORT" "$SRCDBUSER" "$SRCDBPASS" "$SRCDBNAME"
+
+        # Check destination MySQL database connectivity
+        echo -e "${YELLOW}#=== Checking destination MySQL database connectivity...${RESET}"
+        check_mysql_connection "$DSTHOST" "$DSTSSHPORT" "$DSTDBUSER" "$DSTDBPASS" "$DSTDBNAME"
+        ;;
+esac
 
 # Example: Check SSH connection for the source host
 check_ssh_connection "$SRCHOST" "$SRCSSHPORT" "$SRCUSER"
@@ -109,4 +430,51 @@ check_ssh_connection "$SRCHOST" "$SRCSSHPORT" "$SRCUSER"
 # Example: Check SSH connection for the destination host
 check_ssh_connection "$DSTHOST" "$DSTSSHPORT" "$DSTUSER"
 
+# Check the commands used by the transfer are installed on each host
+echo -e "${YELLOW}#=== Checking required tools...${RESET}"
+case "${DB_TYPE:-mysql}" in
+    postgresql|pgsql) dump_tool="pg_dump"; restore_tool="pg_restore" ;;
+    *) dump_tool="mysqldump"; restore_tool="mysql" ;;
+esac
+priority_tools="${NICE_LEVEL:+nice} ${IONICE_CLASS:+ionice}"
+local_tools="rsync"
+if [ "$SRCHOST" != "localhost" ] || { [ "$DSTHOST" != "localhost" ] && [ "$DSTHOST" != "127.0.0.1" ]; }; then
+    local_tools="rsync ssh scp"
+fi
+check_tools local localhost "" "" $local_tools
+# Table validation and the charset report query both databases with the SQL client
+query_tool=""
+if [ "${DB_VALIDATE:-count}" != "none" ] || [ "$RUN_VERIFY" = true ] || [ -n "$DB_CHARSET_FROM" ]; then
+    case "${DB_TYPE:-mysql}" in
+        postgresql|pgsql) query_tool="psql" ;;
+        *) query_tool="mysql" ;;
+    esac
+fi
+check_tools src "$SRCHOST" "$SRCSSHPORT" "$SRCUSER" rsync $dump_tool $query_tool $priority_tools ${SQLITE_FILES:+sqlite3}
+search_replace_tools=""
+if [ ${#SEARCH_REPLACE[@]} -gt 0 ]; then
+    search_replace_tools="wp"
+fi
+check_tools dst "$DSTHOST" "$DSTSSHPORT" "$DSTUSER" rsync $restore_tool $query_tool $priority_tools $search_replace_tools
+
+# Check dumps can be staged (not needed when they are piped into the restore,
+# but SQLite snapshots are always staged)
+if [ "$DB_STREAM" != true ] || [ -n "$SQLITE_FILES" ]; then
+    echo -e "${YELLOW}#=== Checking dump directory ${DB_DUMP_DIR:-/tmp}...${RESET}"
+    check_dump_dir src "$SRCHOST" "$SRCSSHPORT" "$SRCUSER"
+    check_dump_dir dst "$DSTHOST" "$DSTSSHPORT" "$DSTUSER"
+fi
+
+# Check the transfer stays within TRANSFER_QUOTA_MB
+if [ "${TRANSFER_QUOTA_MB:-0}" -gt 0 ]; then
+    echo -e "${YELLOW}#=== Checking transfer size against TRANSFER_QUOTA_MB...${RESET}"
+    check_transfer_quota
+fi
+
+# Check the destination can hold the source directories
+if [ "${CAPACITY_CHECK:-true}" = true ]; then
+    echo -e "${YELLOW}#=== Checking free space and inodes on destination $DSTHOST...${RESET}"
+    check_destination_capacity
+fi
+
 echo -e "${GREEN}#=== Precheck completed successfully!${RESET}"
@@ -0,0 +1,15 @@
+# Priority helpers so heavy copies, dumps and restores can run below the
+# live workload on shared hosts (see NICE_LEVEL and IONICE_CLASS in
+# config_var.sh).
+
+# Function to print the command prefix that applies NICE_LEVEL and IONICE_CLASS
+get_priority_prefix() {
+    local prefix=""
+    if [ -n "$NICE_LEVEL" ]; then
+        prefix="nice -n $NICE_LEVEL "
+    fi
+    if [ -n "$IONICE_CLASS" ]; then
+        prefix="${prefix}ionice -c $IONICE_CLASS "
+    fi
+    echo "$prefix"
+}
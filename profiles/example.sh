@@ -0,0 +1,15 @@
+##### Example profile: ./transfer.sh --profile example
+# Loaded after config_var.sh, so only values that differ need to be set.
+# Variables from config_var.sh can be reused in the values below.
+
+SITE="example"                     # Account name used in the values below
+
+SRCUSER="$SITE"
+SRCDBNAME="${SITE}_db"
+SRCDBUSER="${SITE}_user"
+SRCHOME="/home/$SITE"
+
+DSTUSER="$SITE"
+DSTDBNAME="${SITE}_db"
+DSTDBUSER="${SITE}_user"
+DSTHOME="/home/$SITE"
@@ -0,0 +1,27 @@
+# Retry helper used by transfer.sh for rsync runs that fail with transient
+# errors (dropped SSH connections, NFS/CIFS I/O hiccups, timeouts).
+
+# rsync exit codes worth retrying: socket I/O (10), file I/O (11), protocol stream (12),
+# partial transfer due to error (23), timeouts (30, 35) and SSH connection errors (255)
+RETRYABLE_RSYNC_CODES=" 10 11 12 23 30 35 255 "
+
+# Function to run rsync (at the configured priority), retrying transient
+# failures with exponential backoff
+# Sets RSYNC_RETRIES_USED to the number of retries that were needed
+rsync_with_retry() {
+    local prefix=$(get_priority_prefix)
+    local retries=${RSYNC_RETRIES:-3}
+    local delay=${RSYNC_RETRY_DELAY:-5}
+    local rc
+
+    for ((RSYNC_RETRIES_USED = 0; ; RSYNC_RETRIES_USED++)); do
+        $prefix rsync "$@"
+        rc=$?
+        if [ $rc -eq 0 ] || [[ "$RETRYABLE_RSYNC_CODES" != *" $rc "* ]] || [ $RSYNC_RETRIES_USED -ge $retries ]; then
+            return $rc
+        fi
+        echo -e "  ${YELLOW}↻ rsync failed with exit code $rc, retrying in $delay seconds ($((RSYNC_RETRIES_USED + 1))/$retries)...${RESET}" >&2
+        sleep "$delay"
+        delay=$((delay * 2))
+    done
+}
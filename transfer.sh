@@ -1,13 +1,121 @@
 #!/bin/bash
 
-# Source the config file to include the variables
-source ./config_var.sh
+# Function to print the command line usage
+usage() {
+    cat <<EOF
+Usage: $0 [options]
 
-# Now, you can use the variables from config.sh in your transfer.sh script
-echo "Starting transfer from $SRCHOST to $DSTHOST..."
+Options:
+  --config FILE       Use FILE instead of ./config_var.sh
+  --profile NAME      Load profiles/NAME.sh on top of the config
+  --resume            Skip steps completed by a previous interrupted run
+  --dry-run           Show what would be copied and deleted without changing anything
+  --verify            Compare the destination with the source and report differences
+  --watch INTERVAL    Repeat --verify every INTERVAL (e.g. 30m) and report drift until stopped
+  --max-duration TIME Stop before the next step once TIME (e.g. 4h, 30m) has passed (exit code 75)
+  --trace-file FILE   Record every command and rsync file action to FILE
+  --lint              Validate the configuration and exit
+  --locks             Show transfer locks and exit
+  --gc                Apply the dump and trash retention policy and exit
+  --churn             Estimate how much of the source changes per day and exit
+  --inventory         List source content by MIME type and exit
+  --help              Show this help and exit
+EOF
+}
 
-# Start time
-start_time=$(date +%s)
+# Parse command line options
+RESUME=false          # --resume: skip steps completed by a previous interrupted run
+DRY_RUN=false         # --dry-run: show what would be copied and deleted without changing anything
+RUN_VERIFY=false      # --verify: compare the destination with the source and report differences
+WATCH_INTERVAL=""     # --watch INTERVAL: repeat --verify every INTERVAL and report drift until stopped
+VERIFY_ARGS=()        # Options passed on to each --verify run started by --watch
+LIST_LOCKS=false      # --locks: show transfer locks and exit
+RUN_GC=false          # --gc: apply the dump and trash retention policy and exit
+PRECHECK_LINT=false   # --lint: validate the configuration and exit
+RUN_CHURN=false       # --churn: estimate how much of the source changes per day and exit
+RUN_INVENTORY=false   # --inventory: list source content by MIME type and exit
+TRACE_FILE=""         # --trace-file FILE: record every command and rsync file action to FILE
+MAX_DURATION=""       # --max-duration TIME: stop before the next step once TIME has passed
+while [ $# -gt 0 ]; do
+    case "$1" in
+        --resume)
+            RESUME=true
+            ;;
+        --dry-run)
+            DRY_RUN=true
+            ;;
+        --verify)
+            RUN_VERIFY=true
+            ;;
+        --watch)
+            if ! [[ "$2" =~ ^[0-9]+[hms]?$ ]]; then
+                echo "Option --watch requires an interval like 30m, 1h or 600" >&2
+                exit 1
+            fi
+            WATCH_INTERVAL=$2
+            shift
+            ;;
+        --locks)
+            LIST_LOCKS=true
+            ;;
+        --gc)
+            RUN_GC=true
+            ;;
+        --lint)
+            PRECHECK_LINT=true
+            ;;
+        --churn)
+            RUN_CHURN=true
+            ;;
+        --inventory)
+            RUN_INVENTORY=true
+            ;;
+        --max-duration)
+            if ! [[ "$2" =~ ^[0-9]+[hms]?$ ]]; then
+                echo "Option --max-duration requires a duration like 4h, 30m or 90s" >&2
+                exit 1
+            fi
+            MAX_DURATION=$2
+            shift
+            ;;
+        --trace-file)
+            if [ -z "$2" ]; then
+                echo "Option --trace-file requires a file name" >&2
+                exit 1
+            fi
+            TRACE_FILE=$2
+            shift
+            ;;
+        --profile)
+            if [ -z "$2" ]; then
+                echo "Option --profile requires a profile name" >&2
+                exit 1
+            fi
+            PROFILE=$2  # Loads profiles/$PROFILE.sh on top of config_var.sh
+            VERIFY_ARGS+=(--profile "$2")
+            shift
+            ;;
+        --config)
+            if [ -z "$2" ]; then
+                echo "Option --config requires a file name" >&2
+                exit 1
+            fi
+            CONFIG_FILE=$2  # Used by load_config.sh instead of ./config_var.sh
+            VERIFY_ARGS+=(--config "$2")
+            shift
+            ;;
+        --help)
+            usage
+            exit 0
+            ;;
+        *)
+            echo "Unknown option: $1" >&2
+            usage >&2
+            exit 1
+            ;;
+    esac
+    shift
+done
 
 # Define color codes
 RED='\033[0;31m'
@@ -16,60 +124,483 @@ YELLOW='\033[0;33m'
 BLUE='\033[0;34m'
 RESET='\033[0m'  # To reset to default color
 
+# Source the config file (and the selected profile) to include the variables
+source ./load_config.sh
+
+# Trace every command to TRACE_FILE, with passwords and tokens redacted
+if [ -n "$TRACE_FILE" ]; then
+    (umask 077; : >> "$TRACE_FILE"; : >> "$TRACE_FILE.rsync")
+    # xtrace prints a quote inside a secret as '\'' so that form is redacted as well
+    exec {TRACE_FD}> >(TRACE_SECRETS="$SRCDBPASS"$'\n'"$DSTDBPASS"$'\n'"$SLACK_WEBHOOK_URL"$'\n'"$TELEGRAM_BOT_TOKEN" awk '
+        BEGIN {
+            n = split(ENVIRON["TRACE_SECRETS"], secrets, "\n")
+            for (i = n; i >= 1; i--) {
+                quoted = secrets[i]
+                if (gsub("\047", "\047\\\\\047\047", quoted) > 0)
+                    secrets[++n] = quoted
+            }
+        }
+        {
+            for (i = 1; i <= n; i++)
+                while (secrets[i] != "" && (p = index($0, secrets[i])) > 0)
+                    $0 = substr($0, 1, p - 1) "****" substr($0, p + length(secrets[i]))
+            print
+            fflush()
+        }' >> "$TRACE_FILE")
+    BASH_XTRACEFD=$TRACE_FD
+    PS4='+ \D{%F %T} ${BASH_SOURCE##*/}:${LINENO}: '
+    set -x
+
+    # rsync logs each file it transfers or deletes next to the trace
+    RSYNC_LOG_OPTION=(--log-file="$TRACE_FILE.rsync")
+fi
+
+# Locks keep two transfers from writing the same destination at once
+source ./lock.sh
+if [ "$LIST_LOCKS" = true ]; then
+    list_locks
+    exit 0
+fi
+
+if [ "$RUN_GC" = true ]; then
+    source ./db_sync.sh
+    gc_dumps
+    gc_trash
+    exit 0
+fi
+
+if [ "$RUN_CHURN" = true ]; then
+    source ./churn.sh
+    estimate_churn
+    exit 0
+fi
+
+if [ "$RUN_INVENTORY" = true ]; then
+    source ./inventory.sh
+    print_inventory
+    exit 0
+fi
+
+# Keep comparing a standby destination with the source, notifying when it drifts
+# out of sync or catches up again
+if [ -n "$WATCH_INTERVAL" ]; then
+    source ./warnings.sh
+    source ./notify.sh
+    echo -e "${GREEN}#=== Watching $DSTHOST for drift from $SRCHOST every $WATCH_INTERVAL (Ctrl+C to stop)...${RESET}"
+    # --verify exits 1 when the standby differs and 2 when it could not be compared
+    watch_state="in sync"
+    while true; do
+        bash "$0" --verify "${VERIFY_ARGS[@]}"
+        case $? in
+            0) new_state="in sync" ;;
+            1) new_state="differs" ;;
+            *) new_state="unknown" ;;
+        esac
+        if [ "$new_state" != "$watch_state" ]; then
+            case $new_state in
+                "in sync") notify "finish" "standby is back in sync with the source" ;;
+                differs) notify "warning" "standby differs from the source, see the --watch output" ;;
+                unknown) notify "warning" "could not compare the standby with the source, see the --watch output" ;;
+            esac
+        fi
+        watch_state=$new_state
+        echo -e "${BLUE}#=== Next comparison in $WATCH_INTERVAL${RESET}"
+        sleep "$WATCH_INTERVAL"
+    done
+fi
+
+# precheck.sh exits after validating the configuration when PRECHECK_LINT is set
+if [ "$PRECHECK_LINT" = true ]; then
+    source ./precheck.sh
+fi
+
+# Non-fatal issues are collected and summarised at the end
+source ./warnings.sh
+
+# Email/Slack/Telegram notifications for start, finish and failure
+source ./notify.sh
+
+# Release locks and report a failure whenever the script exits
+on_exit() {
+    local rc=$?
+    release_locks
+    print_warnings
+    # 75 is a --max-duration stop, already reported as a warning
+    if [ $rc -ne 0 ] && [ $rc -ne 75 ] && [ "$READ_ONLY" != true ]; then
+        notify "failure" "(exit code $rc)"
+    fi
+    # --verify keeps exit code 1 for differences; failing before the verdict means it could not compare
+    if [ $rc -ne 0 ] && [ "$RUN_VERIFY" = true ] && [ "$VERIFY_DONE" != true ]; then
+        exit 2
+    fi
+}
+trap on_exit EXIT
+
+# Now, you can use the variables from config.sh in your transfer.sh script
+# --dry-run and --verify only read, they never change the destination
+READ_ONLY=false
+if [ "$DRY_RUN" = true ] || [ "$RUN_VERIFY" = true ]; then
+    READ_ONLY=true
+fi
+
+if [ "$RUN_VERIFY" = true ]; then
+    echo "Comparing $DSTHOST with $SRCHOST..."
+elif [ "$DRY_RUN" = true ]; then
+    echo "Planning transfer from $SRCHOST to $DSTHOST (dry run, nothing will be changed)..."
+else
+    echo "Starting transfer from $SRCHOST to $DSTHOST..."
+    notify "start"
+fi
+
+# Start time
+start_time=$(date +%s)
+
 # Include pre-check script (if necessary)
 source ./precheck.sh
 
-echo -e "${GREEN}#=== Starting website copy from $SRCHOST to $DSTHOST...${RESET}"
+# Lock every destination directory and the destination database (read-only runs change nothing)
+if [ "$READ_ONLY" != true ]; then
+    for i in "${!DSTHOME_DIRS[@]}"; do
+        acquire_lock "files:$DSTHOST:$DSTHOME/${DSTHOME_DIRS[$i]}"
+    done
+    acquire_lock "db:$DSTHOST:$DSTDBNAME"
+fi
+
+# Checkpoints let an interrupted transfer continue with --resume
+source ./checkpoint.sh
+# --verify compares everything, including the steps a checkpoint says are done
+if [ "$RESUME" = true ] && [ "$RUN_VERIFY" = true ]; then
+    echo -e "${YELLOW}#=== --resume has no effect with --verify, comparing every directory${RESET}"
+    RESUME=false
+fi
+if [ "$RESUME" = true ] && [ -s "$STATE_FILE" ]; then
+    echo -e "${YELLOW}#=== Resuming from checkpoint $STATE_FILE...${RESET}"
+elif [ "$READ_ONLY" = true ]; then
+    STATE_FILE=""  # Include every step without touching the checkpoint of an earlier run
+else
+    checkpoint_reset
+fi
+
+# Pause/resume/cancel signals are handled between steps
+source ./control.sh
+
+# User-defined commands to run before/after each step (not in read-only runs)
+source ./hooks.sh
+if [ "$READ_ONLY" = true ]; then
+    HOOKS=()
+fi
+
+# Retries for transient rsync failures, run at the configured priority
+source ./priority.sh
+source ./retry.sh
+
+# Post-copy verification of each directory, the --dry-run plan and --verify report
+source ./verify.sh
+PLAN_BYTES=0
+VERIFY_FAILURES=0
+VERIFY_ERRORS=0
+
+run_hook "pre_files"
+
+if [ "$READ_ONLY" != true ]; then
+    echo -e "${GREEN}#=== Starting website copy from $SRCHOST to $DSTHOST...${RESET}"
+fi
+TRASH_STAMP=$(date +%Y%m%d_%H%M%S)  # Groups files moved to trash by this run
+# Partly copied files are kept in PARTIAL_DIR so an interrupted copy continues them
+RSYNC_PARTIAL_OPTION=()
+if [ -n "$PARTIAL_DIR" ]; then
+    RSYNC_PARTIAL_OPTION=(--partial-dir="$PARTIAL_DIR")
+fi
+# Compression used on the wire (-z) for remote copies
+RSYNC_COMPRESS_OPTION=()
+if [ -n "$COMPRESS_CHOICE" ]; then
+    RSYNC_COMPRESS_OPTION+=(--compress-choice="$COMPRESS_CHOICE")
+fi
+if [ -n "$COMPRESS_LEVEL" ]; then
+    RSYNC_COMPRESS_OPTION+=(--compress-level="$COMPRESS_LEVEL")
+fi
 # Step 1: Rsync files from source to destination/local
 # Loop through source directories and copy to destination
 for i in "${!SRCHOME_DIRS[@]}"; do
     SRCHOME_DIR=${SRCHOME_DIRS[$i]}
     DSTHOME_DIR=${DSTHOME_DIRS[$i]}
-    echo -e "${BLUE}#=== Copying from $SRCHOME/$SRCHOME_DIR to $DSTHOME/$DSTHOME_DIR...${RESET}"
+    wait_if_paused
+    stop_if_out_of_time
+    if [ "$RUN_VERIFY" = true ]; then
+        echo -e "${BLUE}#=== Comparing $DSTHOME/$DSTHOME_DIR with $SRCHOME/$SRCHOME_DIR...${RESET}"
+    else
+        echo -e "${BLUE}#=== Copying from $SRCHOME/$SRCHOME_DIR to $DSTHOME/$DSTHOME_DIR...${RESET}"
+    fi
+
+    if checkpoint_done "files:$SRCHOME_DIR"; then
+        echo -e "  ${YELLOW}↷ Already copied, skipping${RESET}"
+        continue
+    fi
 
     # Initialize rsync exclude option
     RSYNC_EXCLUDE_OPTION=""
 
-    # Check if there are exclusions for this source directory
-    if [ -n "${EXCLUDE_MAP[$SRCHOME_DIR]}" ]; then
-        # Add exclusions for the specific source directory
-        for exclude in ${EXCLUDE_MAP[$SRCHOME_DIR]}; do
-            RSYNC_EXCLUDE_OPTION="$RSYNC_EXCLUDE_OPTION --exclude=$exclude"
-        done
+    # Add the exclusions for this source directory (or the global EXCLUDE_FILES)
+    # and the file types that are never copied (SKIP_PATTERNS)
+    for exclude in ${EXCLUDE_MAP[$SRCHOME_DIR]:-$EXCLUDE_FILES} $SKIP_PATTERNS; do
+        RSYNC_EXCLUDE_OPTION="$RSYNC_EXCLUDE_OPTION --exclude=$exclude"
+    done
+
+    # Files over MAX_FILE_SIZE are left out as well
+    if [ -n "$MAX_FILE_SIZE" ]; then
+        RSYNC_EXCLUDE_OPTION="$RSYNC_EXCLUDE_OPTION --max-size=$MAX_FILE_SIZE"
+    fi
+
+    # SQLite databases (SQLITE_FILES) are copied as snapshots after the database step,
+    # so the live files and their -wal/-shm/-journal files are left out here
+    for sqlite_file in $SQLITE_FILES; do
+        if [[ "$sqlite_file" == "$SRCHOME_DIR/"* ]]; then
+            for suffix in "" -wal -shm -journal; do
+                RSYNC_EXCLUDE_OPTION="$RSYNC_EXCLUDE_OPTION --exclude=/${sqlite_file#"$SRCHOME_DIR/"}$suffix"
+            done
+        fi
+    done
+
+    # Files that must never be overwritten (KEEP_EXISTING_PATTERNS) are left out of
+    # the main copy and only copied afterwards when missing at the destination
+    RSYNC_KEEP_INCLUDE_OPTION=""
+    RSYNC_KEEP_EXCLUDE_OPTION=""
+    for pattern in $KEEP_EXISTING_PATTERNS; do
+        RSYNC_KEEP_INCLUDE_OPTION="$RSYNC_KEEP_INCLUDE_OPTION --include=$pattern"
+        RSYNC_KEEP_EXCLUDE_OPTION="$RSYNC_KEEP_EXCLUDE_OPTION --exclude=$pattern"
+    done
+
+    # Symlinks are kept as links (-a) unless SYMLINK_POLICY says to copy their
+    # targets or leave them out; HARDLINKS keeps hardlinked files linked
+    RSYNC_LINK_OPTION=()
+    case "${SYMLINK_POLICY:-preserve}" in
+        follow) RSYNC_LINK_OPTION=(--copy-links) ;;
+        skip) RSYNC_LINK_OPTION=(--no-links) ;;
+    esac
+    if [ "$HARDLINKS" = true ]; then
+        RSYNC_LINK_OPTION+=(--hard-links)
     fi
 
     # Determine the source and destination based on whether they are local or remote
     # We suppress detailed stats (-q) but keep progress (-P or --info=progress2) if interactive, 
     # but for a clean script output, we'll hide the wall of text and just show the result.
-    
+    RSYNC_SSH_OPTION=()
+    RSYNC_SRC="$SRCHOME/$SRCHOME_DIR/"
+    RSYNC_DST="$DSTHOME/$DSTHOME_DIR/"
+
     if [ "$DSTHOST" = "localhost" ] || [ "$DSTHOST" = "127.0.0.1" ]; then
-        if [ "$SRCHOST" = "localhost" ]; then
-            # Local copy without SSH
-            rsync -az --no-o --no-g --info=progress2 $RSYNC_EXCLUDE_OPTION "$SRCHOME/$SRCHOME_DIR/" "$DSTHOME/$DSTHOME_DIR/"
-        else
+        if [ "$SRCHOST" != "localhost" ]; then
             # Remote copy with SSH
-            rsync -az --no-o --no-g --info=progress2 -e "ssh -p $SRCSSHPORT" $RSYNC_EXCLUDE_OPTION "$SRCUSER@$SRCHOST:$SRCHOME/$SRCHOME_DIR/" "$DSTHOME/$DSTHOME_DIR/"
+            RSYNC_SSH_OPTION=(-e "ssh -p $SRCSSHPORT")
+            RSYNC_SRC="$SRCUSER@$SRCHOST:$RSYNC_SRC"
         fi
+        # Otherwise local copy without SSH
     else
         # Remote copy with SSH on remote destination
-        rsync -az --no-o --no-g --info=progress2 -e "ssh -p $SRCSSHPORT" $RSYNC_EXCLUDE_OPTION "$SRCUSER@$SRCHOST:$SRCHOME/$SRCHOME_DIR/" "$DSTUSER@$DSTHOST:$DSTHOME/$DSTHOME_DIR/"
+        RSYNC_SSH_OPTION=(-e "ssh -p $SRCSSHPORT")
+        RSYNC_SRC="$SRCUSER@$SRCHOST:$RSYNC_SRC"
+        RSYNC_DST="$DSTUSER@$DSTHOST:$RSYNC_DST"
     fi
 
-    if [ $? -eq 0 ]; then
-        echo -e "  ${GREEN}✔ Success${RESET}"
-    else
-        echo -e "  ${RED}✘ Failed${RESET}" >&2
-        exit 1
+    # Run the remote rsync at the configured priority too
+    if [ ${#RSYNC_SSH_OPTION[@]} -gt 0 ] && [ -n "$(get_priority_prefix)" ]; then
+        RSYNC_SSH_OPTION+=(--rsync-path="$(get_priority_prefix)rsync")
+    fi
+
+    # Report differences instead of copying (VERIFY_MAP/VERIFY_MODE pick the comparison)
+    if [ "$RUN_VERIFY" = true ]; then
+        verify_mode=${VERIFY_MAP[$DSTHOME_DIR]:-${VERIFY_MODE:-size}}
+        if [ "$verify_mode" = "none" ]; then
+            verify_mode="size"
+        fi
+        compare_directory "$verify_mode" "${RSYNC_SSH_OPTION[@]}" "${RSYNC_LINK_OPTION[@]}" $RSYNC_EXCLUDE_OPTION $RSYNC_KEEP_EXCLUDE_OPTION "$RSYNC_SRC" "$RSYNC_DST"
+        case $? in
+            1) VERIFY_FAILURES=$((VERIFY_FAILURES + 1)) ;;
+            2) VERIFY_ERRORS=$((VERIFY_ERRORS + 1)) ;;
+        esac
+        continue
+    fi
+
+    # Mirror deletions (DELETE_EXTRANEOUS) with safety rails
+    RSYNC_DELETE_OPTION=()
+    if [ "$DELETE_EXTRANEOUS" = true ]; then
+        RSYNC_DELETE_OPTION=(--delete)
+        read -ra DELETE_PROTECT_PATTERNS <<< "$DELETE_PROTECT"
+        for pattern in "${DELETE_PROTECT_PATTERNS[@]}"; do
+            RSYNC_DELETE_OPTION+=(--filter="P $pattern")
+        done
+        if [ "$DELETE_TRASH" = true ]; then
+            # Deleted (and overwritten) files are moved here instead of being unlinked
+            RSYNC_DELETE_OPTION+=(--backup --backup-dir="$DSTHOME/.transfer-trash/$TRASH_STAMP/$DSTHOME_DIR")
+        fi
+        if ! check_delete_threshold "${DELETE_MAX_PERCENT:-10}" "${RSYNC_SSH_OPTION[@]}" "${RSYNC_LINK_OPTION[@]}" $RSYNC_EXCLUDE_OPTION $RSYNC_KEEP_EXCLUDE_OPTION "${RSYNC_DELETE_OPTION[@]}" "$RSYNC_SRC" "$RSYNC_DST"; then
+            exit 1
+        fi
+    fi
+
+    if [ "$DRY_RUN" = true ]; then
+        plan_directory "${RSYNC_SSH_OPTION[@]}" "${RSYNC_LINK_OPTION[@]}" $RSYNC_EXCLUDE_OPTION $RSYNC_KEEP_EXCLUDE_OPTION "${RSYNC_DELETE_OPTION[@]}" "$RSYNC_SRC" "$RSYNC_DST" || exit 1
+        continue
     fi
+
+    # Copy, then verify; files that changed while being copied are picked up by another pass
+    # (VERIFY_MAP overrides VERIFY_MODE per destination directory)
+    verify_mode=${VERIFY_MAP[$DSTHOME_DIR]:-${VERIFY_MODE:-none}}
+    for ((pass = 0; ; pass++)); do
+        # After a checksum mismatch, compare contents too, or files with the same size
+        # and modification time would never be sent again
+        RSYNC_PASS_OPTION=()
+        if [ $pass -gt 0 ] && [ "$verify_mode" = "checksum" ]; then
+            RSYNC_PASS_OPTION=(--checksum ${CHECKSUM_ALGO:+--checksum-choice=$CHECKSUM_ALGO})
+        fi
+        rsync_with_retry -az --no-o --no-g --info=progress2 "${RSYNC_SSH_OPTION[@]}" "${RSYNC_COMPRESS_OPTION[@]}" "${RSYNC_LINK_OPTION[@]}" "${RSYNC_PASS_OPTION[@]}" $RSYNC_EXCLUDE_OPTION $RSYNC_KEEP_EXCLUDE_OPTION "${RSYNC_DELETE_OPTION[@]}" "${RSYNC_PARTIAL_OPTION[@]}" "${RSYNC_LOG_OPTION[@]}" "$RSYNC_SRC" "$RSYNC_DST"
+        RSYNC_RC=$?
+
+        # Exit code 24: source files vanished during the copy (rotated logs, cache files)
+        if [ $RSYNC_RC -eq 24 ] && [ "${VANISHED_FILES:-warn}" = "warn" ]; then
+            warn "Some source files vanished during the copy of $SRCHOME_DIR"
+            RSYNC_RC=0
+        fi
+
+        if [ $RSYNC_RC -eq 0 ]; then
+            if [ $RSYNC_RETRIES_USED -gt 0 ]; then
+                echo -e "  ${GREEN}✔ Success (after $RSYNC_RETRIES_USED retries)${RESET}"
+            else
+                echo -e "  ${GREEN}✔ Success${RESET}"
+            fi
+        else
+            echo -e "  ${RED}✘ Failed${RESET}" >&2
+            exit 1
+        fi
+
+        # Compare the copy with its source
+        verify_directory "$verify_mode" "${RSYNC_SSH_OPTION[@]}" "${RSYNC_LINK_OPTION[@]}" $RSYNC_EXCLUDE_OPTION $RSYNC_KEEP_EXCLUDE_OPTION "$RSYNC_SRC" "$RSYNC_DST"
+        VERIFY_RC=$?
+        if [ $VERIFY_RC -eq 0 ]; then
+            break
+        fi
+        if [ $VERIFY_RC -eq 2 ]; then
+            exit 1
+        fi
+        # On a live site some files may keep changing; VERIFY_STRICT=false reports them instead of failing
+        if [ $pass -ge ${CHANGED_FILES_RETRIES:-0} ]; then
+            if [ "${VERIFY_STRICT:-true}" != false ]; then
+                echo -e "  ${RED}✘ $SRCHOME_DIR still differs from the source after $((pass + 1)) copy passes${RESET}" >&2
+                exit 1
+            fi
+            warn "$SRCHOME_DIR still differs from the source after $((pass + 1)) copy passes (files changing during the copy)"
+            break
+        fi
+        echo -e "  ${YELLOW}↻ Source changed during the copy, copying again ($((pass + 1))/$CHANGED_FILES_RETRIES)...${RESET}"
+    done
+
+    # Copy files matching KEEP_EXISTING_PATTERNS only where the destination has none yet
+    if [ -n "$RSYNC_KEEP_INCLUDE_OPTION" ]; then
+        rsync_with_retry -az --no-o --no-g --ignore-existing --prune-empty-dirs "${RSYNC_SSH_OPTION[@]}" "${RSYNC_COMPRESS_OPTION[@]}" "${RSYNC_LINK_OPTION[@]}" $RSYNC_EXCLUDE_OPTION --include='*/' $RSYNC_KEEP_INCLUDE_OPTION --exclude='*' "${RSYNC_PARTIAL_OPTION[@]}" "${RSYNC_LOG_OPTION[@]}" "$RSYNC_SRC" "$RSYNC_DST"
+        if [ $? -ne 0 ]; then
+            echo -e "  ${RED}✘ Failed to copy missing $KEEP_EXISTING_PATTERNS files${RESET}" >&2
+            exit 1
+        fi
+    fi
+    checkpoint_mark "files:$SRCHOME_DIR"
 done
 
+run_hook "post_files"
+
+# --verify compares the database too, then stops with the overall result
+if [ "$RUN_VERIFY" = true ]; then
+    source ./db_sync.sh
+    echo -e "${BLUE}#=== Comparing database $DSTDBNAME on $DSTHOST with $SRCDBNAME on $SRCHOST...${RESET}"
+    db_validate_mode=${DB_VALIDATE:-count}
+    if [ "$db_validate_mode" = "none" ]; then
+        db_validate_mode="count"
+    fi
+    validate_database "$db_validate_mode"
+    case $? in
+        1) VERIFY_FAILURES=$((VERIFY_FAILURES + 1)) ;;
+        2) VERIFY_ERRORS=$((VERIFY_ERRORS + 1)) ;;
+    esac
+
+    # Exit 1 when anything differs, 2 when nothing differs but something could not be compared
+    VERIFY_DONE=true
+    if [ $VERIFY_ERRORS -gt 0 ]; then
+        echo -e "${RED}#=== $VERIFY_ERRORS of $((${#SRCHOME_DIRS[@]} + 1)) directories and databases could not be compared${RESET}" >&2
+    fi
+    if [ $VERIFY_FAILURES -gt 0 ]; then
+        echo -e "${RED}#=== $VERIFY_FAILURES of $((${#SRCHOME_DIRS[@]} + 1)) directories and databases differ from the source${RESET}" >&2
+        exit 1
+    fi
+    if [ $VERIFY_ERRORS -gt 0 ]; then
+        exit 2
+    fi
+    echo -e "${GREEN}#=== All ${#SRCHOME_DIRS[@]} directories and the database match the source${RESET}"
+    exit 0
+fi
+
+# A dry run stops here with the plan totals
+if [ "$DRY_RUN" = true ]; then
+    if ! checkpoint_done "database"; then
+        echo -e "${BLUE}#=== Would sync $DB_TYPE database $SRCDBNAME on $SRCHOST to $DSTDBNAME on $DSTHOST${RESET}"
+    fi
+    for ((i = 0; i + 1 < ${#SEARCH_REPLACE[@]}; i += 2)); do
+        echo -e "${BLUE}#=== Would replace '${SEARCH_REPLACE[$i]}' with '${SEARCH_REPLACE[$((i + 1))]}' in $DSTDBNAME${RESET}"
+    done
+    if [ -n "$SQLITE_FILES" ] && ! checkpoint_done "sqlite"; then
+        echo -e "${BLUE}#=== Would snapshot SQLite databases: $SQLITE_FILES${RESET}"
+    fi
+    awk -v b="$PLAN_BYTES" -v r="${DRY_RUN_RATE_MB:-50}" \
+        'BEGIN {printf "#=== Plan: %.1f MB of files to copy, about %d seconds at %d MB/s\n", b / 1048576, b / 1048576 / r + 0.5, r}'
+    exit 0
+fi
+
 # Step 2: Database Synchronization
 source ./db_sync.sh
 
 # Call the sync function (uses defaults from config_var.sh)
 # To sync a different database, pass arguments:
 # sync_database "src_host" "src_port" ...
-sync_database
+if checkpoint_done "database"; then
+    echo -e "${YELLOW}#=== Database already synced, skipping${RESET}"
+else
+    wait_if_paused
+    stop_if_out_of_time
+    run_hook "pre_database"
+    sync_database
+    # The source keeps changing after the dump on a live site, so a mismatch only
+    # fails the transfer with DB_VALIDATE_STRICT
+    validate_database "${DB_VALIDATE:-count}"
+    DB_VALIDATE_RC=$?
+    if [ $DB_VALIDATE_RC -ne 0 ] && [ "$DB_VALIDATE_STRICT" = true ]; then
+        exit 1
+    fi
+    if [ $DB_VALIDATE_RC -eq 2 ]; then
+        warn "Database $DSTDBNAME could not be validated against the source"
+    elif [ $DB_VALIDATE_RC -ne 0 ]; then
+        warn "Database $DSTDBNAME differs from the source, possibly rows written after the dump"
+    fi
+    search_replace_database
+    run_hook "post_database"
+    checkpoint_mark "database"
+fi
+
+# SQLite databases inside the copied directories are replaced by consistent snapshots
+if [ -n "$SQLITE_FILES" ]; then
+    if checkpoint_done "sqlite"; then
+        echo -e "${YELLOW}#=== SQLite databases already synced, skipping${RESET}"
+    else
+        wait_if_paused
+        stop_if_out_of_time
+        sync_sqlite_files
+        checkpoint_mark "sqlite"
+    fi
+fi
+
+# Remove old dumps according to the retention policy
+gc_dumps
+gc_trash
+
+# All steps finished, the checkpoint is no longer needed
+checkpoint_clear
 
 # End time
 end_time=$(date +%s)
@@ -77,3 +608,7 @@ end_time=$(date +%s)
 duration=$((end_time - start_time))
 
 echo -e "${GREEN}#=== Website and database copy completed successfully in $duration seconds.${RESET}"
+if [ ${#WARNINGS[@]} -gt 0 ]; then
+    notify "warning" "$(IFS=';'; echo "${#WARNINGS[@]} warning(s): ${WARNINGS[*]}")"
+fi
+notify "finish" "in $duration seconds"
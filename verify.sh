@@ -0,0 +1,155 @@
+# Dry-run helpers used by transfer.sh to compare a copied directory with
+# its source, to check mirror deletions before they happen and to plan a
+# --dry-run. They only run rsync with -n, so nothing is written.
+
+# Function to verify a directory copy
+# Usage: verify_directory <mode> [rsync options...] <source> <destination>
+# Modes: none (skip), size (compare file sizes), checksum (compare file contents)
+# Returns 1 if any difference was found, 2 if the verification could not run
+verify_directory() {
+    local mode=$1
+    shift
+    local verify_option
+
+    case "$mode" in
+        none)
+            return 0
+            ;;
+        size)
+            verify_option="--size-only"
+            ;;
+        checksum)
+            verify_option="--checksum"
+            if [ -n "$CHECKSUM_ALGO" ]; then
+                verify_option="$verify_option --checksum-choice=$CHECKSUM_ALGO"
+            fi
+            ;;
+        *)
+            echo -e "  ${RED}✘ Unknown verification mode '$mode'${RESET}" >&2
+            return 2
+            ;;
+    esac
+
+    echo -e "  ${BLUE}Verifying ($mode)...${RESET}"
+    local output
+    if ! output=$(rsync -rln --itemize-changes $verify_option "$@" 2>&1); then
+        echo -e "  ${RED}✘ Verification could not run${RESET}" >&2
+        echo "$output" | sed 's/^/    /' >&2
+        return 2
+    fi
+
+    # Itemized lines for files that would be sent or created are differences
+    local differences=$(echo "$output" | grep -E '^[<>ch]')
+    if [ -n "$differences" ]; then
+        echo -e "  ${RED}✘ Verification found $(echo "$differences" | wc -l) difference(s):${RESET}" >&2
+        echo "$differences" | sed 's/^/    /' >&2
+        return 1
+    fi
+    echo -e "  ${GREEN}✔ Verified${RESET}"
+}
+
+# Function to stop a mirror from deleting too much of the destination
+# Usage: check_delete_threshold <max percent> [rsync options...] <source> <destination>
+check_delete_threshold() {
+    local max_percent=$1
+    shift
+
+    local output
+    if ! output=$(rsync -rln --itemize-changes --stats "$@" 2>&1); then
+        echo -e "  ${RED}✘ Delete check could not run${RESET}" >&2
+        echo "$output" | sed 's/^/    /' >&2
+        return 1
+    fi
+
+    # Compare deletions with the number of entries the destination will hold afterwards
+    local deletes=$(echo "$output" | grep -c '^\*deleting')
+    local files=$(echo "$output" | sed -n 's/^Number of files: \([0-9,]*\).*/\1/p' | tr -d ',')
+    local total=$((deletes + ${files:-0}))
+
+    if [ $deletes -eq 0 ]; then
+        return 0
+    fi
+    if [ $((deletes * 100)) -gt $((max_percent * total)) ]; then
+        echo -e "  ${RED}✘ Refusing to delete $deletes of $total destination entries (limit $max_percent%)${RESET}" >&2
+        echo "$output" | grep '^\*deleting' | head -20 | sed 's/^/    /' >&2
+        return 1
+    fi
+    warn "$deletes extraneous entries will be removed from ${!#}"
+}
+
+# Function to print what copying a directory would change
+# Usage: plan_directory [rsync options...] <source> <destination>
+# Adds the number of bytes that would be sent to PLAN_BYTES
+plan_directory() {
+    local output
+    if ! output=$(rsync -an --no-o --no-g --itemize-changes --stats "$@" 2>&1); then
+        echo -e "  ${RED}✘ Plan could not run${RESET}" >&2
+        echo "$output" | sed 's/^/    /' >&2
+        return 1
+    fi
+
+    local files=$(echo "$output" | grep -cE '^[<>ch]f')
+    local deletes=$(echo "$output" | grep -c '^\*deleting')
+    local bytes=$(echo "$output" | sed -n 's/^Total transferred file size: \([0-9,]*\).*/\1/p' | tr -d ',')
+    PLAN_BYTES=$((PLAN_BYTES + ${bytes:-0}))
+
+    awk -v f="$files" -v b="${bytes:-0}" -v d="$deletes" \
+        'BEGIN {printf "  Would copy %d files (%.1f MB) and delete %d entries\n", f, b / 1048576, d}'
+}
+
+# Function to print a report of how a directory differs from its source
+# Usage: compare_directory <mode> [rsync options...] <source> <destination>
+# Modes: size (compare sizes and modification times), checksum (compare file contents)
+# Returns 1 if any difference was found, 2 if the comparison could not run
+compare_directory() {
+    local mode=$1
+    shift
+    local compare_option=""
+    if [ "$mode" = "checksum" ]; then
+        compare_option="--checksum"
+        if [ -n "$CHECKSUM_ALGO" ]; then
+            compare_option="$compare_option --checksum-choice=$CHECKSUM_ALGO"
+        fi
+    fi
+
+    local output
+    if ! output=$(rsync -rlptn --itemize-changes --delete $compare_option "$@" 2>&1); then
+        echo -e "  ${RED}✘ Comparison could not run${RESET}" >&2
+        echo "$output" | sed 's/^/    /' >&2
+        return 2
+    fi
+
+    # Sort itemized changes (YXcstp...) into categories; names start at column 13
+    local report=$(echo "$output" | awk '
+        /^\*deleting/ { dst[++nd] = substr($0, 13); next }
+        /^[<>ch.]/ {
+            flags = substr($0, 1, 11)
+            name = substr($0, 13)
+            if (substr(flags, 3, 9) == "+++++++++") src[++ns] = name
+            else if (substr(flags, 2, 1) != "f") next
+            else if (substr(flags, 4, 1) == "s") size[++nz] = name
+            else if (substr(flags, 3, 1) == "c") sum[++nc] = name
+            else if (substr(flags, 5, 1) ~ /[tT]/) mtime[++nt] = name
+            else if (substr(flags, 6, 1) == "p") perm[++np] = name
+        }
+        function section(title, list, n,    i) {
+            if (n == 0) return
+            printf "  %s (%d):\n", title, n
+            for (i = 1; i <= n; i++) printf "    %s\n", list[i]
+        }
+        END {
+            section("Only in source", src, ns)
+            section("Only in destination", dst, nd)
+            section("Size differs", size, nz)
+            section("Content differs", sum, nc)
+            section("Modification time differs", mtime, nt)
+            section("Permissions differ", perm, np)
+        }')
+
+    if [ -n "$report" ]; then
+        echo -e "  ${RED}✘ Differences found ($mode):${RESET}"
+        echo "$report"
+        return 1
+    fi
+    echo -e "  ${GREEN}✔ Identical ($mode)${RESET}"
+}
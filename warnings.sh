@@ -0,0 +1,25 @@
+# Warning helpers shared by the scripts. Non-fatal issues (vanished files,
+# failed hooks with HOOK_ON_FAILURE=continue, stale locks, ...) are printed
+# when they happen and summarised again at the end of the run.
+
+# Keep warnings already recorded when this file is sourced again
+declare -a WARNINGS
+
+# Function to print a warning and record it for the end-of-run summary
+warn() {
+    local message=$1
+    WARNINGS+=("$message")
+    echo -e "  ${YELLOW}⚠ $message${RESET}" >&2
+}
+
+# Function to print every warning recorded during the run
+print_warnings() {
+    local message
+    if [ ${#WARNINGS[@]} -eq 0 ]; then
+        return 0
+    fi
+    echo -e "${YELLOW}#=== ${#WARNINGS[@]} warning(s) during this run:${RESET}"
+    for message in "${WARNINGS[@]}"; do
+        echo "  - $message"
+    done
+}